@@ -0,0 +1,291 @@
+// Package augment randomly distorts training images on the fly, so the network sees a new variation
+// of every digit in each epoch instead of the exact same images.
+package augment
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+// Config selects how often each transform is applied and how strong it is.
+// A transform with probability 0 is disabled.
+type Config struct {
+	// Random rotation, scaling, shearing and translation around the image center
+	Affine      float64 // Probability
+	MaxRotation float64 // Degrees in either direction
+	MaxScale    float64 // Relative change, e.g. 0.1 scales by 0.9-1.1
+	MaxShear    float64 // Horizontal shift per row
+	MaxShift    float64 // Pixels in either direction
+
+	// Elastic distortion (Simard et al., 2003): a random displacement field smoothed by a Gaussian
+	Elastic      float64 // Probability
+	ElasticAlpha float64 // Scale of the displacements
+	ElasticSigma float64 // Standard deviation of the smoothing in pixels
+
+	// Additive Gaussian noise
+	Noise    float64 // Probability
+	NoiseStd float64
+
+	// Random erasing of a rectangle, which simulates broken or occluded strokes
+	Erase        float64 // Probability
+	EraseMaxArea float64 // Largest fraction of the image erased
+
+	// Stroke thickness: grayscale dilation or erosion with a 3x3 cross, chosen with equal chance
+	Morph float64 // Probability
+}
+
+// Default returns moderate augmentation that keeps digits recognizable.
+func Default() Config {
+	return Config{
+		Affine: 0.5, MaxRotation: 15, MaxScale: 0.1, MaxShear: 0.3, MaxShift: 2,
+		Elastic: 0.3, ElasticAlpha: 34, ElasticSigma: 4,
+		Noise: 0.2, NoiseStd: 0.1,
+		Erase: 0.2, EraseMaxArea: 0.15,
+		Morph: 0.2,
+	}
+}
+
+// probabilities lists the transforms in the order they are applied, with their names in a spec.
+func (c *Config) probabilities() []struct {
+	name string
+	p    *float64
+} {
+	return []struct {
+		name string
+		p    *float64
+	}{{"morph", &c.Morph}, {"affine", &c.Affine}, {"elastic", &c.Elastic}, {"erase", &c.Erase}, {"noise", &c.Noise}}
+}
+
+// Enabled reports whether any transform has a non-zero probability.
+func (c Config) Enabled() bool {
+	for _, t := range c.probabilities() {
+		if *t.p > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the probabilities of the enabled transforms in the form accepted by Parse, "none" if none is enabled.
+func (c Config) String() string {
+	var parts []string
+	for _, t := range c.probabilities() {
+		if *t.p > 0 {
+			parts = append(parts, t.name+"="+strconv.FormatFloat(*t.p, 'g', -1, 64))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ",")
+}
+
+// Parse reads the probability of each transform from a spec such as "affine=0.5,elastic=0.3,noise=0.2".
+// Transforms not listed are disabled and the strengths are those of Default. "default" selects Default,
+// "none" or an empty string disables augmentation. The transforms are affine, elastic, noise, erase and morph.
+func Parse(spec string) (Config, error) {
+	cfg := Default()
+	switch spec = strings.TrimSpace(spec); spec {
+	case "default":
+		return cfg, nil
+	case "", "none":
+		spec = ""
+	}
+	for _, t := range cfg.probabilities() {
+		*t.p = 0
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		if spec == "" {
+			break
+		}
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		var target *float64
+		for _, t := range cfg.probabilities() {
+			if t.name == name {
+				target = t.p
+			}
+		}
+		if target == nil {
+			return Config{}, fmt.Errorf("unknown augmentation %q (expected affine, elastic, noise, erase or morph)", name)
+		}
+		p, err := strconv.ParseFloat(value, 64)
+		if err != nil || p < 0 || p > 1 {
+			return Config{}, fmt.Errorf("invalid probability %q for %s (expected 0-1)", value, name)
+		}
+		*target = p
+	}
+	return cfg, nil
+}
+
+// Augmenter applies the transforms of a Config using its own source of randomness.
+// It is not safe for concurrent use; create one Augmenter per goroutine.
+type Augmenter struct {
+	Config
+	Rows, Cols int // Size of the images
+	rand       *rand.Rand
+}
+
+// New returns an Augmenter for rows x cols images. The same seed yields the same sequence of distortions.
+func New(cfg Config, rows, cols int, seed int64) *Augmenter {
+	return &Augmenter{Config: cfg, Rows: rows, Cols: cols, rand: rand.New(rand.NewSource(seed))}
+}
+
+// Apply returns a randomly distorted copy of pixels. Every transform is applied with its probability,
+// in the order morphology, affine, elastic, erasing, noise. The result is clipped to 0.0-1.0.
+func (a *Augmenter) Apply(pixels []float64) []float64 {
+	img := preprocess.New(append([]float64(nil), pixels...), a.Rows, a.Cols)
+	if a.happens(a.Morph) {
+		img = morph(img, a.rand.Intn(2) == 0)
+	}
+	if a.happens(a.Affine) {
+		img = a.affine(img)
+	}
+	if a.happens(a.Elastic) {
+		img = a.elastic(img)
+	}
+	if a.happens(a.Erase) {
+		a.erase(img)
+	}
+	if a.happens(a.Noise) {
+		for i := range img.Pixels {
+			img.Pixels[i] += a.rand.NormFloat64() * a.NoiseStd
+		}
+	}
+	for i, v := range img.Pixels {
+		img.Pixels[i] = math.Max(0, math.Min(1, v))
+	}
+	return img.Pixels
+}
+
+// happens reports true with probability p.
+func (a *Augmenter) happens(p float64) bool {
+	return p > 0 && a.rand.Float64() < p
+}
+
+// uniform returns a random number between -limit and limit.
+func (a *Augmenter) uniform(limit float64) float64 {
+	return (2*a.rand.Float64() - 1) * limit
+}
+
+// affine rotates, scales and shears img around its center and translates it.
+func (a *Augmenter) affine(img preprocess.Image) preprocess.Image {
+	theta := a.uniform(a.MaxRotation) * math.Pi / 180
+	scale := 1 + a.uniform(a.MaxScale)
+	shear := a.uniform(a.MaxShear)
+	tx, ty := a.uniform(a.MaxShift), a.uniform(a.MaxShift)
+
+	// Forward transform: rotation * scale * shear; the image is sampled through its inverse
+	cos, sin := math.Cos(theta), math.Sin(theta)
+	m00, m01 := scale*cos, scale*(cos*shear-sin)
+	m10, m11 := scale*sin, scale*(sin*shear+cos)
+	det := m00*m11 - m01*m10
+	cx, cy := float64(img.Cols)/2, float64(img.Rows)/2
+	return preprocess.Warp(img, preprocess.Bilinear, func(x, y float64) (float64, float64) {
+		dx, dy := x-cx-tx, y-cy-ty
+		return cx + (m11*dx-m01*dy)/det, cy + (-m10*dx+m00*dy)/det
+	})
+}
+
+// elastic displaces every pixel by a smooth random field.
+func (a *Augmenter) elastic(img preprocess.Image) preprocess.Image {
+	n := img.Rows * img.Cols
+	dx, dy := make([]float64, n), make([]float64, n)
+	for i := range dx {
+		dx[i], dy[i] = a.uniform(1), a.uniform(1)
+	}
+	kernel := gaussianKernel(a.ElasticSigma)
+	dx = smooth(dx, img.Rows, img.Cols, kernel)
+	dy = smooth(dy, img.Rows, img.Cols, kernel)
+	return preprocess.Warp(img, preprocess.Bilinear, func(x, y float64) (float64, float64) {
+		i := int(y)*img.Cols + int(x)
+		return x + a.ElasticAlpha*dx[i], y + a.ElasticAlpha*dy[i]
+	})
+}
+
+// gaussianKernel returns a normalized 1D Gaussian kernel with a radius of three standard deviations.
+func gaussianKernel(sigma float64) []float64 {
+	radius := max(1, int(math.Ceil(3*sigma)))
+	kernel := make([]float64, 2*radius+1)
+	sum := 0.0
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// smooth convolves a rows x cols field with kernel horizontally and vertically, treating the outside as 0.
+func smooth(field []float64, rows, cols int, kernel []float64) []float64 {
+	radius := len(kernel) / 2
+	tmp := make([]float64, len(field))
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			for k, w := range kernel {
+				if sx := x + k - radius; sx >= 0 && sx < cols {
+					tmp[y*cols+x] += w * field[y*cols+sx]
+				}
+			}
+		}
+	}
+	out := make([]float64, len(field))
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			for k, w := range kernel {
+				if sy := y + k - radius; sy >= 0 && sy < rows {
+					out[y*cols+x] += w * tmp[sy*cols+x]
+				}
+			}
+		}
+	}
+	return out
+}
+
+// erase blanks a random rectangle of img in place. Its area is 2% to EraseMaxArea of the image
+// and its aspect ratio between 1:3 and 3:1.
+func (a *Augmenter) erase(img preprocess.Image) {
+	area := (0.02 + a.rand.Float64()*math.Max(0, a.EraseMaxArea-0.02)) * float64(img.Rows*img.Cols)
+	aspect := math.Exp(a.uniform(math.Log(3)))
+	w := min(img.Cols, max(1, int(math.Round(math.Sqrt(area*aspect)))))
+	h := min(img.Rows, max(1, int(math.Round(math.Sqrt(area/aspect)))))
+	x0, y0 := a.rand.Intn(img.Cols-w+1), a.rand.Intn(img.Rows-h+1)
+	for y := y0; y < y0+h; y++ {
+		for x := x0; x < x0+w; x++ {
+			img.Pixels[y*img.Cols+x] = 0
+		}
+	}
+}
+
+// morph thickens (dilate) or thins the strokes of img by taking the maximum or minimum
+// over every pixel and its four neighbors.
+func morph(img preprocess.Image, dilate bool) preprocess.Image {
+	out := preprocess.New(make([]float64, len(img.Pixels)), img.Rows, img.Cols)
+	for y := 0; y < img.Rows; y++ {
+		for x := 0; x < img.Cols; x++ {
+			v := img.Pixels[y*img.Cols+x]
+			for _, d := range [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				nx, ny := x+d[0], y+d[1]
+				n := 0.0 // Outside the image is background
+				if nx >= 0 && ny >= 0 && nx < img.Cols && ny < img.Rows {
+					n = img.Pixels[ny*img.Cols+nx]
+				}
+				if dilate {
+					v = math.Max(v, n)
+				} else {
+					v = math.Min(v, n)
+				}
+			}
+			out.Pixels[y*img.Cols+x] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,171 @@
+package augment
+
+import (
+	"math"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+// digit returns a 28x28 image with a bright vertical bar, roughly like a "1".
+func digit() []float64 {
+	pixels := make([]float64, 28*28)
+	for y := 6; y < 22; y++ {
+		for x := 12; x < 16; x++ {
+			pixels[y*28+x] = 1
+		}
+	}
+	return pixels
+}
+
+func sum(pixels []float64) float64 {
+	total := 0.0
+	for _, v := range pixels {
+		total += v
+	}
+	return total
+}
+
+func equal(a, b []float64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+func TestApplyDeterministic(t *testing.T) {
+	a, b := New(Default(), 28, 28, 42), New(Default(), 28, 28, 42)
+	changed := false
+	for i := 0; i < 20; i++ {
+		x, y := a.Apply(digit()), b.Apply(digit())
+		if !equal(x, y) {
+			t.Fatalf("Sample %d: Expected the same seed to give the same distortion", i)
+		}
+		changed = changed || !equal(x, digit())
+	}
+	if !changed {
+		t.Error("Expected the default augmentation to change some of the images")
+	}
+	if equal(New(Default(), 28, 28, 1).Apply(digit()), New(Default(), 28, 28, 2).Apply(digit())) &&
+		equal(New(Default(), 28, 28, 3).Apply(digit()), New(Default(), 28, 28, 4).Apply(digit())) {
+		t.Error("Expected different seeds to give different distortions")
+	}
+}
+
+func TestApplyRangeAndInput(t *testing.T) {
+	cfg := Default()
+	cfg.Affine, cfg.Elastic, cfg.Noise, cfg.Erase, cfg.Morph = 1, 1, 1, 1, 1
+	a := New(cfg, 28, 28, 7)
+	in := digit()
+	for i := 0; i < 10; i++ {
+		out := a.Apply(in)
+		if len(out) != len(in) {
+			t.Fatalf("Expected %d pixels, Got %d", len(in), len(out))
+		}
+		for _, v := range out {
+			if v < 0 || v > 1 {
+				t.Fatalf("Expected pixels within 0.0-1.0, Got %f", v)
+			}
+		}
+	}
+	if !equal(in, digit()) {
+		t.Error("Expected the input to be left unchanged")
+	}
+
+	if out := New(Config{}, 28, 28, 7).Apply(in); !equal(out, in) || &out[0] == &in[0] {
+		t.Error("Expected a disabled augmenter to return an unchanged copy")
+	}
+}
+
+func TestMorph(t *testing.T) {
+	img := preprocess.New(digit(), 28, 28)
+	if got := sum(morph(img, true).Pixels); got <= sum(img.Pixels) {
+		t.Errorf("Expected dilation to add ink: %f <= %f", got, sum(img.Pixels))
+	}
+	if got := sum(morph(img, false).Pixels); got >= sum(img.Pixels) {
+		t.Errorf("Expected erosion to remove ink: %f >= %f", got, sum(img.Pixels))
+	}
+}
+
+func TestErase(t *testing.T) {
+	a := New(Config{Erase: 1, EraseMaxArea: 0.15}, 28, 28, 3)
+	full := make([]float64, 28*28)
+	for i := range full {
+		full[i] = 1
+	}
+	for i := 0; i < 20; i++ {
+		erased := float64(len(full)) - sum(a.Apply(full))
+		if erased < 1 || erased > 0.2*float64(len(full)) {
+			t.Fatalf("Expected 1 pixel to 20%% of the image to be erased, Got %.0f pixels", erased)
+		}
+	}
+}
+
+func TestAffineKeepsInk(t *testing.T) {
+	// Small rotations and shifts move the digit but keep it roughly intact and near the center
+	a := New(Config{Affine: 1, MaxRotation: 15, MaxScale: 0.1, MaxShear: 0.3, MaxShift: 2}, 28, 28, 5)
+	for i := 0; i < 20; i++ {
+		out := a.Apply(digit())
+		if ratio := sum(out) / sum(digit()); ratio < 0.7 || ratio > 1.3 {
+			t.Errorf("Sample %d: Expected the ink to be roughly preserved, Got a ratio of %.2f", i, ratio)
+		}
+		cx, cy := 0.0, 0.0
+		for j, v := range out {
+			cx += float64(j%28) * v
+			cy += float64(j/28) * v
+		}
+		cx, cy = cx/sum(out), cy/sum(out)
+		if math.Hypot(cx-14, cy-14) > 4 {
+			t.Errorf("Sample %d: Expected the digit to stay near the center, Got (%.1f, %.1f)", i, cx, cy)
+		}
+	}
+}
+
+func TestProbabilities(t *testing.T) {
+	a := New(Config{Noise: 0.3, NoiseStd: 0.1}, 28, 28, 9)
+	blank := make([]float64, 28*28)
+	noisy := 0
+	for i := 0; i < 1000; i++ {
+		if sum(a.Apply(blank)) > 0 {
+			noisy++
+		}
+	}
+	if noisy < 250 || noisy > 350 {
+		t.Errorf("Expected about 300 of 1000 images to get noise, Got %d", noisy)
+	}
+}
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse("affine=0.5, noise=0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Affine != 0.5 || cfg.Noise != 0.2 || cfg.Elastic != 0 || cfg.Erase != 0 || cfg.Morph != 0 {
+		t.Errorf("Unexpected probabilities %+v", cfg)
+	}
+	if cfg.MaxRotation != Default().MaxRotation || cfg.NoiseStd != Default().NoiseStd {
+		t.Errorf("Expected the default strengths, Got %+v", cfg)
+	}
+	if got := cfg.String(); got != "affine=0.5,noise=0.2" {
+		t.Errorf("Expected %q, Got %q", "affine=0.5,noise=0.2", got)
+	}
+
+	if cfg, err := Parse("default"); err != nil || cfg != Default() {
+		t.Errorf("Expected the default config, Got %+v, %v", cfg, err)
+	}
+	if got := Default().String(); got != "morph=0.2,affine=0.5,elastic=0.3,erase=0.2,noise=0.2" {
+		t.Errorf("Unexpected default spec %q", got)
+	}
+	for _, spec := range []string{"", "none"} {
+		if cfg, err := Parse(spec); err != nil || cfg.Enabled() || cfg.String() != "none" {
+			t.Errorf("Parse(%q): Expected augmentation to be disabled, Got %q, %v", spec, cfg, err)
+		}
+	}
+	for _, spec := range []string{"blur=0.5", "affine", "affine=1.5", "noise=-0.1", "erase=x", "affine=0.5,"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q): Expected an error", spec)
+		}
+	}
+}
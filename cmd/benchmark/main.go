@@ -17,16 +17,11 @@ const (
 	outputSize  = 10
 	modelPath   = "mnist_model.gob"
 	sampleCount = 10
+	batchSize   = 256 // Batch size for the batched throughput measurement
 )
 
 func main() {
-	// 1. Load Model
-	net := neural.NewNetwork(inputSize, hiddenSize, outputSize, 0.0)
-	if err := net.LoadModel(modelPath); err != nil {
-		log.Fatalf("Error loading model: %v", err)
-	}
-
-	// 2. Load Test Data
+	// 1. Load Test Data
 	testImagePath := filepath.Join("data", "t10k-images-idx3-ubyte.gz")
 	testLabelPath := filepath.Join("data", "t10k-labels-idx1-ubyte.gz")
 	testImagesData, _, err := utils.LoadMNIST(testImagePath, testLabelPath)
@@ -34,34 +29,50 @@ func main() {
 		log.Fatalf("Error loading data: %v", err)
 	}
 
-	fmt.Printf("Benchmarking inference on %d samples...\n", sampleCount)
+	// 2. Load the same model file in both precisions and measure each
+	avg64, batch64 := benchmark(neural.NewNetwork(inputSize, hiddenSize, outputSize, 0.0), testImagesData)
+	avg32, batch32 := benchmark(neural.NewNetwork32(inputSize, hiddenSize, outputSize, 0.0), testImagesData)
+
+	fmt.Println("================================================")
+	fmt.Printf("%-10s %14s %16s %22s\n", "Precision", "Avg Inference", "Throughput", fmt.Sprintf("Batched (%d)", batchSize))
+	fmt.Printf("%-10s %14v %10.0f img/s %16.0f img/s\n", "float64", avg64, float64(time.Second)/float64(avg64), batch64)
+	fmt.Printf("%-10s %14v %10.0f img/s %16.0f img/s\n", "float32", avg32, float64(time.Second)/float64(avg32), batch32)
+}
+
+// benchmark loads the model into net, measures sampleCount predictions in precision T
+// and returns the average inference time together with the batched throughput in images per second.
+func benchmark[T matrix.Float](net *neural.Model[T], testImagesData *utils.ImageData) (time.Duration, float64) {
+	if err := net.LoadModel(modelPath); err != nil {
+		log.Fatalf("Error loading model: %v", err)
+	}
+
+	fmt.Printf("Benchmarking %T inference on %d samples...\n", T(0), sampleCount)
 	fmt.Println("------------------------------------------------")
 
 	var totalDuration time.Duration
 
 	// Prepare matrices in advance to measure only prediction time
-	inputs := make([]matrix.Matrix, sampleCount)
+	inputs := make([]matrix.Dense[T], sampleCount)
 	for i := 0; i < sampleCount; i++ {
-		inputs[i] = matrix.NewMatrix(1, inputSize)
-		inputs[i][0] = testImagesData.Images[i]
+		inputs[i] = matrix.Convert[T](matrix.Matrix{testImagesData.Images[i]})
 	}
 
 	// Warm-up (perform one prediction to load everything into cache/memory)
-	_, _ = net.Predict(inputs[0])
+	_, _ = net.PredictProba(inputs[0])
 
 	// 3. Measure
 	for i := 0; i < sampleCount; i++ {
 		start := time.Now()
-		
-		_, err := net.Predict(inputs[i])
+
+		_, err := net.PredictProba(inputs[i])
 		if err != nil {
 			log.Printf("Prediction error: %v", err)
 			continue
 		}
-		
+
 		duration := time.Since(start)
 		totalDuration += duration
-		
+
 		fmt.Printf("Sample %2d: %v\n", i+1, duration)
 	}
 
@@ -69,10 +80,36 @@ func main() {
 	fmt.Println("------------------------------------------------")
 	fmt.Printf("Total Time: %v\n", totalDuration)
 	fmt.Printf("Average Inference Time: %v\n", avgDuration)
-	
+
 	if avgDuration < 10*time.Millisecond {
 		fmt.Println("✅ Goal Achieved: Under 10ms per inference")
 	} else {
 		fmt.Println("⚠️ Goal Missed: Over 10ms per inference")
 	}
+
+	// 4. Measure batched throughput over the whole test set
+	throughput := batchThroughput(net, testImagesData)
+	fmt.Printf("Batched Throughput (batch size %d): %.0f img/s\n", batchSize, throughput)
+	fmt.Println()
+
+	return avgDuration, throughput
+}
+
+// batchThroughput runs PredictBatch over the whole test set in batches of batchSize
+// and returns the number of images predicted per second.
+func batchThroughput[T matrix.Float](net *neural.Model[T], testImagesData *utils.ImageData) float64 {
+	total := int(testImagesData.NumImages)
+	batches := make([]matrix.Dense[T], 0, (total+batchSize-1)/batchSize)
+	for start := 0; start < total; start += batchSize {
+		end := min(start+batchSize, total)
+		batches = append(batches, matrix.Convert[T](matrix.Matrix(testImagesData.Images[start:end])))
+	}
+
+	start := time.Now()
+	for _, batch := range batches {
+		if _, err := net.PredictBatch(batch); err != nil {
+			log.Printf("Batch prediction error: %v", err)
+		}
+	}
+	return float64(total) / time.Since(start).Seconds()
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/coolspeed/go-mnist-scratch/eval"
+	"github.com/coolspeed/go-mnist-scratch/logging"
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/metrics"
+	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+	"github.com/coolspeed/go-mnist-scratch/report"
+	"github.com/coolspeed/go-mnist-scratch/utils"
+)
+
+const (
+	inputSize  = 784 // 28x28 pixels
+	hiddenSize = 200
+	outputSize = 10 // 0-9 digits
+)
+
+func main() {
+	metricsPath := flag.String("metrics", "metrics.csv", "Metrics log written by cmd/train -metrics")
+	modelPath := flag.String("model", "mnist_model.gob", "Trained model file")
+	outPath := flag.String("out", "report.html", "Output HTML file")
+	worst := flag.Int("worst", 32, "Number of most confident misclassifications to show")
+	var logOpts logging.Options
+	logOpts.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := logOpts.Setup(); err != nil {
+		logging.Fatal("invalid logging flags", "err", err)
+	}
+
+	// 1. Load Metrics
+	records, err := metrics.ReadFile(*metricsPath)
+	if err != nil {
+		slog.Warn("error loading metrics, training curves will be empty", "path", *metricsPath, "err", err)
+	}
+
+	// 2. Load Model
+	net := neural.NewNetwork(inputSize, hiddenSize, outputSize, 0.0)
+	if err := net.LoadModel(*modelPath); err != nil {
+		logging.Fatal("error loading model", "path", *modelPath, "err", err)
+	}
+
+	// 3. Evaluate on Test Data
+	testImagePath := filepath.Join("data", "t10k-images-idx3-ubyte.gz")
+	testLabelPath := filepath.Join("data", "t10k-labels-idx1-ubyte.gz")
+	testImagesData, testLabelsData, err := utils.LoadMNIST(testImagePath, testLabelPath)
+	if err != nil {
+		logging.Fatal("error loading testing data", "err", err)
+	}
+	// Prepare the test images like the model's training images; models saved without a pipeline were trained on raw ones
+	var pipeline preprocess.Pipeline
+	if net.Meta.Preprocess == "" {
+		slog.Warn("model has no recorded preprocessing pipeline, evaluating the raw test images", "path", *modelPath)
+	} else if pipeline, err = preprocess.Parse(net.Meta.Preprocess); err != nil {
+		logging.Fatal("invalid preprocessing pipeline in the model", "err", err)
+	}
+	if testImagesData, err = testImagesData.Preprocess(pipeline); err != nil {
+		logging.Fatal("error preprocessing testing data", "err", err)
+	}
+
+	slog.Info("evaluating test samples", "count", testImagesData.NumImages)
+	confusion := eval.NewConfusionMatrix(outputSize)
+	var mistakes []report.Mistake
+	for i := 0; i < int(testImagesData.NumImages); i++ {
+		top, err := net.PredictTopK(matrix.Matrix{testImagesData.Images[i]}, 1)
+		if err != nil {
+			slog.Error("error predicting test sample", "index", i, "err", err)
+			continue
+		}
+		predicted := top[0].Label
+
+		actual := int(testLabelsData.Labels[i])
+		confusion.Add(actual, predicted)
+		if predicted != actual {
+			mistakes = append(mistakes, report.Mistake{
+				Index:      i,
+				Actual:     actual,
+				Predicted:  predicted,
+				Confidence: top[0].Probability,
+				Pixels:     testImagesData.Images[i],
+			})
+		}
+	}
+	sort.Slice(mistakes, func(a, b int) bool {
+		return mistakes[a].Confidence > mistakes[b].Confidence
+	})
+	if len(mistakes) > *worst {
+		mistakes = mistakes[:*worst]
+	}
+
+	// 4. Write Report
+	file, err := os.Create(*outPath)
+	if err != nil {
+		logging.Fatal("error creating report", "path", *outPath, "err", err)
+	}
+	defer file.Close()
+
+	err = report.Write(file, &report.Data{
+		Title:     "MNIST Training Report",
+		ModelPath: *modelPath,
+		Records:   records,
+		Confusion: confusion,
+		Mistakes:  mistakes,
+		W1:        net.W1,
+		ImageRows: int(testImagesData.NumRows),
+		ImageCols: int(testImagesData.NumCols),
+	})
+	if err != nil {
+		logging.Fatal("error writing report", "path", *outPath, "err", err)
+	}
+	slog.Info("report written", "path", *outPath)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// adminToken is the bearer token required by the admin endpoints. They are disabled if it is empty.
+var adminToken string
+
+// authorized reports whether r carries the admin bearer token.
+func authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// adminReloadHandler reloads every model file, or only the one named by ?model=, and reports the active versions.
+func adminReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if adminToken == "" {
+		http.Error(w, "Admin endpoints are disabled (no -admin-token configured)", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	holders := models.Holders()
+	if name := r.URL.Query().Get("model"); name != "" {
+		h, ok := models.Get(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown model %q", name), http.StatusNotFound)
+			return
+		}
+		holders = []*modelHolder{h}
+	}
+
+	type reloadResult struct {
+		Model         string `json:"model"`
+		Reloaded      bool   `json:"reloaded"`
+		ModelVersion  int64  `json:"model_version"`
+		ModelChecksum string `json:"model_checksum"`
+		Error         string `json:"error,omitempty"`
+	}
+	status := http.StatusOK
+	results := make([]reloadResult, 0, len(holders))
+	for _, h := range holders {
+		m, reloaded, err := h.Reload()
+		result := reloadResult{Model: h.name, Reloaded: reloaded, ModelVersion: m.version, ModelChecksum: m.checksum}
+		if err != nil {
+			result.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"models": results})
+}
+
+// withModelHeaders adds the name, version and checksum of the default model to every response of next.
+// Prediction handlers replace them with the model that actually answered.
+func withModelHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := models.Default(); h != nil {
+			setModelHeaders(w, h.Load())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setModelHeaders sets the X-Model-Name, X-Model-Version and X-Model-Checksum headers to m.
+func setModelHeaders(w http.ResponseWriter, m *loadedModel) {
+	w.Header().Set("X-Model-Name", m.name)
+	w.Header().Set("X-Model-Version", strconv.FormatInt(m.version, 10))
+	w.Header().Set("X-Model-Checksum", m.checksum)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+var (
+	// maxBatchSize is the maximum number of images in a single /predict/batch request.
+	maxBatchSize = 256
+	// maxBatchBytes is the maximum size of a /predict/batch request body.
+	maxBatchBytes int64 = 8 << 20
+)
+
+// batchResponse is the JSON body returned by /predict/batch.
+type batchResponse struct {
+	Results       []*predictResponse `json:"results"` // One result per image, in request order
+	DurationUS    int64              `json:"duration_us"`
+	Model         string             `json:"model"`
+	ModelVersion  int64              `json:"model_version"`
+	ModelChecksum string             `json:"model_checksum"`
+}
+
+// batchPredictHandler predicts an array of images in a single batched forward pass.
+// Every result carries the batch inference time divided by the number of images as its duration_us.
+func batchPredictHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h, err := models.Route(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Cannot route the request: %v", err), http.StatusNotFound)
+		return
+	}
+
+	var requestData struct {
+		Images []string `json:"images"` // Comma-separated strings, one per image
+	}
+
+	parseStart := time.Now()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBytes)
+	err = json.NewDecoder(r.Body).Decode(&requestData)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(requestData.Images) == 0 {
+		http.Error(w, "Expected at least one image", http.StatusBadRequest)
+		return
+	}
+	if len(requestData.Images) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("Batch of %d images exceeds the limit of %d", len(requestData.Images), maxBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	images := make([]preprocess.Image, len(requestData.Images))
+	for i, image := range requestData.Images {
+		pixels, err := parsePixels(image)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Image %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		images[i] = preprocess.New(pixels, preprocess.MNISTSize, preprocess.MNISTSize)
+	}
+	serverMetrics.observeStage("parse", time.Since(parseStart))
+
+	preprocessStart := time.Now()
+	model := h.Load() // Preprocess and predict with the same snapshot
+	inputMatrix := make(matrix.Matrix, len(images))
+	for i, img := range images {
+		if inputMatrix[i], err = model.Preprocess(img); err != nil {
+			http.Error(w, fmt.Sprintf("Image %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+	serverMetrics.observeStage("preprocess", time.Since(preprocessStart))
+
+	// Measure pure inference time of the whole batch
+	startTime := time.Now()
+	probs, err := model.PredictBatch(inputMatrix)
+	inferenceDuration := time.Since(startTime)
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Prediction failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	serverMetrics.observeStage("inference", inferenceDuration)
+	for _, p := range probs {
+		serverMetrics.observePrediction(model.name, p)
+	}
+	models.CompareShadow(requestLogger(r.Context()), h, images, probs, model)
+
+	response := &batchResponse{
+		Results:       make([]*predictResponse, len(probs)),
+		DurationUS:    inferenceDuration.Microseconds(),
+		Model:         model.name,
+		ModelVersion:  model.version,
+		ModelChecksum: model.checksum,
+	}
+	perImage := inferenceDuration / time.Duration(len(probs))
+	for i, p := range probs {
+		response.Results[i] = newPredictResponse(p, model)
+		response.Results[i].DurationUS = perImage.Microseconds()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	setModelHeaders(w, model)
+	json.NewEncoder(w).Encode(response)
+}
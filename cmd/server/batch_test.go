@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+func postBatch(t *testing.T, images []string) *httptest.ResponseRecorder {
+	t.Helper()
+	requestBody, _ := json.Marshal(map[string][]string{"images": images})
+	req, err := http.NewRequest("POST", "/predict/batch", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(batchPredictHandler).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBatchPredictHandler(t *testing.T) {
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+
+	blank := strings.Repeat("0.0,", 783) + "0.0"
+	stroke := strings.Repeat("0.0,", 400) + strings.Repeat("1.0,", 20) + strings.Repeat("0.0,", 363) + "0.0"
+	images := []string{blank, stroke, blank}
+
+	rr := postBatch(t, images)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var response batchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Results) != len(images) {
+		t.Fatalf("Expected %d results, got %d", len(images), len(response.Results))
+	}
+
+	// Every batched result must match the single-image prediction
+	for i, image := range images {
+		pixels, err := parsePixels(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := models.Default().Load()
+		input, err := m.Preprocess(preprocess.New(pixels, 28, 28))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := m.net.Predict([][]float64{input})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := response.Results[i].Prediction; got != expected {
+			t.Errorf("Image %d: batch prediction %d differs from single prediction %d", i, got, expected)
+		}
+		if len(response.Results[i].Probabilities) != 10 {
+			t.Errorf("Image %d: expected 10 probabilities, got %d", i, len(response.Results[i].Probabilities))
+		}
+	}
+}
+
+func TestBatchPredictHandlerLimits(t *testing.T) {
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	blank := strings.Repeat("0.0,", 783) + "0.0"
+
+	defer func(size int, bytes int64) { maxBatchSize, maxBatchBytes = size, bytes }(maxBatchSize, maxBatchBytes)
+
+	maxBatchSize = 2
+	if rr := postBatch(t, []string{blank, blank, blank}); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Batch above the size limit: got status %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	maxBatchSize = 10
+	maxBatchBytes = 1000
+	if rr := postBatch(t, []string{blank}); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Body above the byte limit: got status %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	maxBatchBytes = 1 << 20
+	if rr := postBatch(t, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Empty batch: got status %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := postBatch(t, []string{"0.5,0.5"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Malformed image: got status %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
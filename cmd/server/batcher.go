@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+)
+
+// batcher gathers concurrent single-image predictions into one batched forward pass.
+// A batch is run as soon as it holds maxBatch images or window has passed since its first image arrived.
+type batcher struct {
+	predict  func(*loadedModel, matrix.Matrix) ([][]float64, error)
+	maxBatch int
+	window   time.Duration
+	requests chan *batchRequest
+	closed   chan struct{} // Closed by Close; requests arriving afterwards fail with errBatcherClosed
+	close    sync.Once
+	done     chan struct{} // Closed when run has answered every queued request and returned
+}
+
+// errBatcherClosed is returned by Predict once the batcher is closed.
+var errBatcherClosed = errors.New("batcher closed")
+
+// batchRequest is one image waiting in the batcher.
+type batchRequest struct {
+	model  *loadedModel // Snapshot the request preprocessed its image with
+	pixels []float64
+	result chan batchResult // Buffered so the batcher never blocks on an abandoned request
+}
+
+// batchResult is the outcome of one image of a batch.
+type batchResult struct {
+	probs []float64
+	err   error
+}
+
+// newBatcher starts a batcher that runs predict over batches of up to maxBatch images of the same model.
+func newBatcher(predict func(*loadedModel, matrix.Matrix) ([][]float64, error), maxBatch int, window time.Duration) *batcher {
+	b := &batcher{
+		predict:  predict,
+		maxBatch: max(1, maxBatch),
+		window:   window,
+		requests: make(chan *batchRequest, max(1, maxBatch)),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Predict queues pixels for the next batch and waits for their class probabilities computed by m.
+// It fails with errBatcherClosed after Close, which is safe
+// for requests that outlive a shutdown.
+func (b *batcher) Predict(ctx context.Context, m *loadedModel, pixels []float64) ([]float64, error) {
+	req := &batchRequest{model: m, pixels: pixels, result: make(chan batchResult, 1)}
+	select {
+	case <-b.closed:
+		return nil, errBatcherClosed
+	default:
+	}
+	select {
+	case b.requests <- req:
+	case <-b.closed:
+		return nil, errBatcherClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-req.result:
+		return res.probs, res.err
+	case <-b.done:
+		// The request may have been queued after run drained the queue for the last time
+		select {
+		case res := <-req.result:
+			return res.probs, res.err
+		default:
+			return nil, errBatcherClosed
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the batcher. Images already queued are still predicted. Close may be called more than once.
+func (b *batcher) Close() {
+	b.close.Do(func() { close(b.closed) })
+	<-b.done
+}
+
+// run collects requests into batches until the batcher is closed, then predicts the queued requests.
+func (b *batcher) run() {
+	defer close(b.done)
+	timer := time.NewTimer(b.window)
+	timer.Stop()
+
+	for {
+		var batch []*batchRequest
+		select {
+		case first := <-b.requests:
+			batch = append(batch, first)
+		case <-b.closed:
+			b.drain()
+			return
+		}
+		timer.Reset(b.window)
+
+	collect:
+		for len(batch) < b.maxBatch {
+			select {
+			case req := <-b.requests:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			case <-b.closed:
+				break collect
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		b.flush(batch)
+	}
+}
+
+// drain predicts the requests left in the queue without waiting for more.
+func (b *batcher) drain() {
+	for {
+		var batch []*batchRequest
+	collect:
+		for len(batch) < b.maxBatch {
+			select {
+			case req := <-b.requests:
+				batch = append(batch, req)
+			default:
+				break collect
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		b.flush(batch)
+	}
+}
+
+// flush runs one forward pass per model over the batch and fans the results back out.
+// Only a batch collected around a reload holds the images of more than one model.
+func (b *batcher) flush(batch []*batchRequest) {
+	for len(batch) > 0 {
+		m := batch[0].model
+		var same, rest []*batchRequest
+		for _, req := range batch {
+			if req.model == m {
+				same = append(same, req)
+			} else {
+				rest = append(rest, req)
+			}
+		}
+
+		inputs := make(matrix.Matrix, len(same))
+		for i, req := range same {
+			inputs[i] = req.pixels
+		}
+		probs, err := b.predict(m, inputs)
+		for i, req := range same {
+			if err != nil {
+				req.result <- batchResult{err: err}
+				continue
+			}
+			req.result <- batchResult{probs: probs[i]}
+		}
+		batch = rest
+	}
+}
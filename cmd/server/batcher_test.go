@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/neural"
+)
+
+// echoPredict returns the first pixel of every row as its "distribution" and records the batch sizes.
+type echoPredict struct {
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (e *echoPredict) predict(m *loadedModel, inputs matrix.Matrix) ([][]float64, error) {
+	e.mu.Lock()
+	e.sizes = append(e.sizes, len(inputs))
+	e.mu.Unlock()
+
+	result := make([][]float64, len(inputs))
+	for i, row := range inputs {
+		result[i] = []float64{row[0]}
+	}
+	return result, nil
+}
+
+func TestBatcherFansOutResults(t *testing.T) {
+	echo := &echoPredict{}
+	b := newBatcher(echo.predict, 4, 20*time.Millisecond)
+	defer b.Close()
+
+	const requests = 10
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			probs, err := b.Predict(context.Background(), nil, []float64{float64(i)})
+			if err != nil {
+				t.Errorf("Request %d: unexpected error: %v", i, err)
+				return
+			}
+			if probs[0] != float64(i) {
+				t.Errorf("Request %d: received the result of request %v", i, probs[0])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, size := range echo.sizes {
+		if size > 4 {
+			t.Errorf("Batch of %d exceeds the maximum of 4", size)
+		}
+		total += size
+	}
+	if total != requests {
+		t.Errorf("Expected %d predicted images, got %d", requests, total)
+	}
+	if len(echo.sizes) >= requests {
+		t.Errorf("Expected concurrent requests to share batches, got batch sizes %v", echo.sizes)
+	}
+}
+
+func TestBatcherWindow(t *testing.T) {
+	echo := &echoPredict{}
+	b := newBatcher(echo.predict, 32, 5*time.Millisecond)
+	defer b.Close()
+
+	// A lone request must not wait for the batch to fill up
+	start := time.Now()
+	if _, err := b.Predict(context.Background(), nil, []float64{1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("A single request took %v, expected about the 5ms window", elapsed)
+	}
+}
+
+func TestBatcherKeepsTheRequestModel(t *testing.T) {
+	// Around a reload, requests of the old and the new snapshot share a batch
+	b := newBatcher(func(m *loadedModel, inputs matrix.Matrix) ([][]float64, error) {
+		result := make([][]float64, len(inputs))
+		for i := range inputs {
+			result[i] = []float64{float64(m.version)}
+		}
+		return result, nil
+	}, 8, 20*time.Millisecond)
+	defer b.Close()
+
+	snapshots := []*loadedModel{{version: 1}, {version: 2}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(m *loadedModel) {
+			defer wg.Done()
+			probs, err := b.Predict(context.Background(), m, []float64{0})
+			if err != nil || probs[0] != float64(m.version) {
+				t.Errorf("Expected the prediction of version %d, Got %v (%v)", m.version, probs, err)
+			}
+		}(snapshots[i%2])
+	}
+	wg.Wait()
+}
+
+func TestBatcherClose(t *testing.T) {
+	echo := &echoPredict{}
+	b := newBatcher(echo.predict, 4, time.Hour)
+
+	// A queued request is still answered when the batcher closes, without waiting for the window
+	req := &batchRequest{pixels: []float64{1}, result: make(chan batchResult, 1)}
+	b.requests <- req
+	b.Close()
+	if res := <-req.result; res.err != nil || res.probs[0] != 1 {
+		t.Errorf("Expected the queued request to be predicted, Got %v (%v)", res.probs, res.err)
+	}
+
+	// Requests after Close, e.g. from handlers outliving a shutdown timeout, fail instead of panicking
+	if _, err := b.Predict(context.Background(), nil, []float64{2}); !errors.Is(err, errBatcherClosed) {
+		t.Errorf("Expected %v after Close, Got %v", errBatcherClosed, err)
+	}
+	b.Close()
+}
+
+// BenchmarkBatcher is a load test of the /predict inference path: 64 concurrent clients predict single
+// images either directly or through the batcher with different windows. It reports the throughput and
+// the median and 99th percentile latency of a request.
+//
+//	go test ./cmd/server -run '^$' -bench Batcher
+func BenchmarkBatcher(b *testing.B) {
+	h := newModelHolder("test", "")
+	if err := h.Set(neural.NewNetwork(inputSize, hiddenSize, outputSize, 0.0)); err != nil {
+		b.Fatal(err)
+	}
+	input := make([]float64, inputSize)
+	for i := 300; i < 400; i++ {
+		input[i] = 1.0
+	}
+
+	configs := []struct {
+		name     string
+		window   time.Duration
+		maxBatch int
+	}{
+		{"direct", 0, 0},
+		{"window=500us/max=8", 500 * time.Microsecond, 8},
+		{"window=2ms/max=32", 2 * time.Millisecond, 32},
+		{"window=5ms/max=64", 5 * time.Millisecond, 64},
+	}
+
+	for _, cfg := range configs {
+		b.Run(cfg.name, func(b *testing.B) {
+			predict := func(pixels []float64) error {
+				_, err := h.Load().net.PredictProba(matrix.Matrix{pixels})
+				return err
+			}
+			if cfg.window > 0 {
+				bt := newBatcher((*loadedModel).PredictBatch, cfg.maxBatch, cfg.window)
+				defer bt.Close()
+				predict = func(pixels []float64) error {
+					_, err := bt.Predict(context.Background(), h.Load(), pixels)
+					return err
+				}
+			}
+
+			var mu sync.Mutex
+			latencies := make([]time.Duration, 0, b.N)
+			b.SetParallelism(64)
+			b.ResetTimer()
+			start := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					t0 := time.Now()
+					if err := predict(input); err != nil {
+						b.Error(err)
+						return
+					}
+					d := time.Since(t0)
+					mu.Lock()
+					latencies = append(latencies, d)
+					mu.Unlock()
+				}
+			})
+			elapsed := time.Since(start)
+			b.StopTimer()
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(len(latencies))/elapsed.Seconds(), "req/s")
+			b.ReportMetric(percentile(latencies, 0.50), "p50-ms")
+			b.ReportMetric(percentile(latencies, 0.99), "p99-ms")
+		})
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies in milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(sorted)-1))
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
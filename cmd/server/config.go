@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/logging"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+// envPrefix prefixes the environment variable of every flag, e.g. MNIST_ADDR for -addr.
+const envPrefix = "MNIST_"
+
+// config holds the server configuration. Every field has a flag and an environment variable;
+// flags take precedence over the environment, which takes precedence over the defaults.
+type config struct {
+	Addr      string
+	ModelPath string
+	ModelDir  string
+	StaticDir string // Empty serves the embedded web UI
+	// Exit instead of serving a fresh network when the model file cannot be loaded
+	RequireModel bool
+
+	// HTTP server limits
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // How long in-flight requests may drain on SIGTERM
+	MaxBodyBytes      int64         // Request body limit of /predict
+	MaxBatchBytes     int64         // Request body limit of /predict/batch
+	MaxBatchSize      int
+
+	// Prediction
+	ConfidenceThreshold float64
+	TopK                int
+	BatchWindow         time.Duration
+	BatchMax            int
+	Invert              string
+
+	// Models
+	DefaultModel  string
+	Split         string
+	Shadow        string
+	WatchInterval time.Duration
+	AdminToken    string
+
+	// Logging
+	Log        logging.Options
+	Debug      bool
+	DebugInput string
+	DebugDir   string
+}
+
+// defaultConfig returns the configuration used when no flag or environment variable is set.
+func defaultConfig() config {
+	return config{
+		Addr:                ":8080",
+		ModelPath:           "mnist_model.gob",
+		ReadTimeout:         10 * time.Second,
+		ReadHeaderTimeout:   5 * time.Second,
+		WriteTimeout:        30 * time.Second,
+		IdleTimeout:         2 * time.Minute,
+		ShutdownTimeout:     15 * time.Second,
+		MaxBodyBytes:        10 << 20,
+		MaxBatchBytes:       8 << 20,
+		MaxBatchSize:        256,
+		ConfidenceThreshold: 0.7,
+		TopK:                3,
+		BatchMax:            32,
+		Invert:              string(preprocess.InvertAuto),
+		WatchInterval:       2 * time.Second,
+		Log:                 logging.Options{Format: "text", Level: "info"},
+		DebugInput:          "ascii",
+		DebugDir:            "debug_inputs",
+	}
+}
+
+// registerFlags registers a flag for every field of c, using the current values as defaults.
+func (c *config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "Address to listen on")
+	fs.StringVar(&c.ModelPath, "model", c.ModelPath, "Model file served as \"default\" when -model-dir is empty")
+	fs.StringVar(&c.ModelDir, "model-dir", c.ModelDir, "Serve every *.gob model in this directory, named after its file")
+	fs.StringVar(&c.StaticDir, "static-dir", c.StaticDir, "Serve the web UI from this directory instead of the embedded files (for development)")
+	fs.BoolVar(&c.RequireModel, "require-model", c.RequireModel, "Exit if the model file cannot be loaded instead of serving a freshly initialized network")
+
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "Maximum duration for reading an entire request")
+	fs.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", c.ReadHeaderTimeout, "Maximum duration for reading request headers")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "Maximum duration before timing out writes of a response")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "Maximum time to wait for the next request on a keep-alive connection")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Maximum time to drain in-flight requests on SIGTERM")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", c.MaxBodyBytes, "Maximum request body size in bytes accepted by /predict")
+	fs.Int64Var(&c.MaxBatchBytes, "max-batch-bytes", c.MaxBatchBytes, "Maximum request body size in bytes accepted by /predict/batch")
+	fs.IntVar(&c.MaxBatchSize, "max-batch-size", c.MaxBatchSize, "Maximum number of images accepted by /predict/batch")
+
+	fs.Float64Var(&c.ConfidenceThreshold, "confidence-threshold", c.ConfidenceThreshold, "Flag predictions whose top probability is below this value as low confidence")
+	fs.IntVar(&c.TopK, "top-k", c.TopK, "Number of most probable labels returned by /predict")
+	fs.DurationVar(&c.BatchWindow, "batch-window", c.BatchWindow, "Gather concurrent /predict calls for up to this long into one batched forward pass (0 = disabled)")
+	fs.IntVar(&c.BatchMax, "batch-max", c.BatchMax, "Run a gathered /predict batch as soon as it holds this many images")
+	fs.StringVar(&c.Invert, "invert", c.Invert, "Invert uploaded PNG/JPEG images to white ink on black: auto, always or never")
+
+	fs.StringVar(&c.DefaultModel, "default-model", c.DefaultModel, "Model answering requests that name no model (default: first model by name)")
+	fs.StringVar(&c.Split, "ab", c.Split, "Weighted A/B split of requests that name no model, e.g. \"prod=90,candidate=10\"")
+	fs.StringVar(&c.Shadow, "shadow", c.Shadow, "Model that scores every request in the background and logs disagreements")
+	fs.DurationVar(&c.WatchInterval, "watch-interval", c.WatchInterval, "Reload a model when its file changes, checking this often (0 = disabled)")
+	fs.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "Bearer token for /admin/reload (endpoint disabled if empty)")
+
+	c.Log.RegisterFlags(fs)
+	fs.BoolVar(&c.Debug, "debug", c.Debug, "Debug mode: log at debug level (same as -log-level debug)")
+	fs.StringVar(&c.DebugInput, "debug-input", c.DebugInput, "In debug mode, dump the centered input of /predict as ascii, png (into -debug-dir) or none")
+	fs.StringVar(&c.DebugDir, "debug-dir", c.DebugDir, "Directory for -debug-input png dumps")
+}
+
+// envName returns the environment variable of a flag, e.g. MNIST_MAX_BODY_BYTES for -max-body-bytes.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig builds the configuration from the defaults, the environment (read through getenv)
+// and the command line arguments, in increasing order of precedence.
+func loadConfig(args []string, getenv func(string) string, output io.Writer) (*config, error) {
+	cfg := defaultConfig()
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(output)
+	cfg.registerFlags(fs)
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		f.Usage += fmt.Sprintf(" [$%s]", envName(f.Name))
+		if v := getenv(envName(f.Name)); v != "" && envErr == nil {
+			if err := fs.Set(f.Name, v); err != nil {
+				envErr = fmt.Errorf("invalid $%s: %w", envName(f.Name), err)
+			}
+		}
+	})
+	if envErr != nil {
+		return nil, envErr
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	if cfg.Debug {
+		cfg.Log.Level = "debug"
+	}
+	if cfg.DebugInput == "none" {
+		cfg.DebugInput = ""
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// validate checks the values that cannot be checked by their type alone.
+func (c *config) validate() error {
+	var errs []error
+	if _, err := preprocess.ParseInvertMode(c.Invert); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.DebugInput {
+	case "", "ascii", "png":
+	default:
+		errs = append(errs, fmt.Errorf("invalid -debug-input %q (expected ascii, png or none)", c.DebugInput))
+	}
+	if c.MaxBodyBytes <= 0 || c.MaxBatchBytes <= 0 || c.MaxBatchSize <= 0 {
+		errs = append(errs, errors.New("body and batch size limits must be positive"))
+	}
+	if c.TopK < 1 {
+		errs = append(errs, fmt.Errorf("invalid -top-k %d (must be at least 1)", c.TopK))
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("-shutdown-timeout must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// apply sets the package settings read by the handlers.
+func (c *config) apply() {
+	confidenceThreshold = c.ConfidenceThreshold
+	topK = c.TopK
+	maxBodyBytes = c.MaxBodyBytes
+	maxBatchBytes = c.MaxBatchBytes
+	maxBatchSize = c.MaxBatchSize
+	staticDir = c.StaticDir
+	invertMode = preprocess.InvertMode(c.Invert)
+	adminToken = c.AdminToken
+	debugInput = c.DebugInput
+	debugDir = c.DebugDir
+}
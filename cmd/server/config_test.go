@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/neural"
+)
+
+func TestLoadConfig(t *testing.T) {
+	env := map[string]string{
+		"MNIST_ADDR":           ":9090",
+		"MNIST_TOP_K":          "5",
+		"MNIST_WRITE_TIMEOUT":  "1m",
+		"MNIST_MAX_BODY_BYTES": "1024",
+		"MNIST_ADMIN_TOKEN":    "secret",
+	}
+	cfg, err := loadConfig([]string{"-top-k", "7", "-debug"}, func(k string) string { return env[k] }, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Addr != ":9090" || cfg.WriteTimeout != time.Minute || cfg.MaxBodyBytes != 1024 || cfg.AdminToken != "secret" {
+		t.Errorf("Expected the environment to override the defaults, got %+v", cfg)
+	}
+	if cfg.TopK != 7 {
+		t.Errorf("Expected the flag to override the environment: Expected top-k 7, Got %d", cfg.TopK)
+	}
+	if cfg.ModelPath != "mnist_model.gob" || cfg.ReadHeaderTimeout != 5*time.Second {
+		t.Errorf("Expected defaults for unset values, got %+v", cfg)
+	}
+	if cfg.Log.Level != "debug" {
+		t.Errorf("Expected -debug to set the debug log level, Got %q", cfg.Log.Level)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	noEnv := func(string) string { return "" }
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{"bad env value", nil, map[string]string{"MNIST_READ_TIMEOUT": "soon"}},
+		{"unknown flag", []string{"-port", "80"}, nil},
+		{"bad invert mode", []string{"-invert", "sometimes"}, nil},
+		{"bad debug input", []string{"-debug-input", "jpeg"}, nil},
+		{"zero body limit", []string{"-max-body-bytes", "0"}, nil},
+		{"positional argument", []string{"extra"}, nil},
+	}
+	for _, tt := range tests {
+		getenv := noEnv
+		if tt.env != nil {
+			getenv = func(k string) string { return tt.env[k] }
+		}
+		if _, err := loadConfig(tt.args, getenv, io.Discard); err == nil {
+			t.Errorf("%s: Expected an error", tt.name)
+		}
+	}
+
+	// The usage names the environment variable of every flag
+	var usage bytes.Buffer
+	loadConfig([]string{"-h"}, noEnv, &usage)
+	if !strings.Contains(usage.String(), "[$MNIST_SHUTDOWN_TIMEOUT]") {
+		t.Errorf("Expected the usage to list environment variables, Got:\n%s", usage.String())
+	}
+}
+
+func TestPredictBodyLimit(t *testing.T) {
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	defer func(limit int64) { maxBodyBytes = limit }(maxBodyBytes)
+	maxBodyBytes = 100
+
+	body, _ := json.Marshal(map[string]string{"image": strings.Repeat("0.0,", 783) + "0.0"})
+	rr := servePredict(t, bytes.NewBuffer(body), "application/json")
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for a body over the limit, Got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	var upload bytes.Buffer
+	if err := png.Encode(&upload, testDigit()); err != nil {
+		t.Fatal(err)
+	}
+	if rr := servePredict(t, &upload, "image/png"); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for an upload over the limit, Got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
+
+func TestRunDrainsOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.gob")
+	if err := neural.NewNetwork(784, 10, 10, 0.1).SaveModel(modelFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reserve a free port for the server
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg, err := loadConfig([]string{"-addr", addr, "-model", modelFile, "-watch-interval", "0", "-batch-window", "300ms"}, func(string) string { return "" }, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	defer captureLog(&logs)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, cfg) }()
+
+	// Wait until the server accepts connections
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The request waits in the 300ms batch window while the server shuts down
+	status := make(chan int, 1)
+	go func() {
+		body, _ := json.Marshal(map[string]string{"image": strings.Repeat("0.0,", 783) + "0.0"})
+		resp, err := http.Post("http://"+addr+"/predict", "application/json", bytes.NewReader(body))
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	if code := <-status; code != http.StatusOK {
+		t.Errorf("Expected the in-flight request to complete with %d, Got %d", http.StatusOK, code)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, Got %v", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected the server to stop accepting connections")
+	}
+}
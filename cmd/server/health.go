@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/neural"
+)
+
+// shuttingDown is set while the server drains in-flight requests, so /readyz takes it out of rotation.
+var shuttingDown atomic.Bool
+
+// healthzHandler reports that the process is alive. It does not depend on the models.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// readyzHandler reports whether the server should receive traffic: every model must have been
+// loaded from its file (not a freshly initialized fallback) and the server must not be shutting down.
+// It responds 503 otherwise.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	type modelStatus struct {
+		Name   string `json:"name"`
+		Ready  bool   `json:"ready"`
+		Reason string `json:"reason,omitempty"`
+	}
+	response := struct {
+		Ready  bool          `json:"ready"`
+		Reason string        `json:"reason,omitempty"`
+		Models []modelStatus `json:"models"`
+	}{Ready: true, Models: []modelStatus{}}
+
+	for _, h := range models.Holders() {
+		status := modelStatus{Name: h.name, Ready: true}
+		switch m := h.Load(); {
+		case m == nil:
+			status.Ready, status.Reason = false, "no model loaded"
+		case m.fallback:
+			status.Ready, status.Reason = false, "serving a freshly initialized network, model file not loaded"
+		}
+		response.Ready = response.Ready && status.Ready
+		response.Models = append(response.Models, status)
+	}
+	switch {
+	case shuttingDown.Load():
+		response.Ready, response.Reason = false, "shutting down"
+	case len(response.Models) == 0:
+		response.Ready, response.Reason = false, "no models"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !response.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// modelInfo is the JSON body returned by /model.
+type modelInfo struct {
+	Name         string              `json:"name"`
+	Version      int64               `json:"version"`
+	Checksum     string              `json:"checksum"`
+	Path         string              `json:"path,omitempty"`
+	LoadedAt     time.Time           `json:"loaded_at"`
+	Fallback     bool                `json:"fallback"` // Freshly initialized, not loaded from a file
+	Architecture neural.Architecture `json:"architecture"`
+	Parameters   int                 `json:"parameters"`
+	SizeBytes    int                 `json:"size_bytes"`
+	Preprocess   string              `json:"preprocess"` // Pipeline applied to every input
+	Training     *neural.Metadata    `json:"training"`   // Null for models saved without training metadata
+}
+
+// modelInfoHandler describes the model named in the path (/models/{name}) or X-Model header,
+// else the default model. The A/B split does not apply.
+func modelInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+	if name == "" {
+		name = r.Header.Get(modelHeader)
+	}
+	h := models.Default()
+	if name != "" {
+		var ok bool
+		if h, ok = models.Get(name); !ok {
+			http.Error(w, fmt.Sprintf("Unknown model %q", name), http.StatusNotFound)
+			return
+		}
+	}
+	if h == nil {
+		http.Error(w, "No model loaded", http.StatusServiceUnavailable)
+		return
+	}
+	m := h.Load()
+
+	info := modelInfo{
+		Name:         m.name,
+		Version:      m.version,
+		Checksum:     m.checksum,
+		Path:         h.path,
+		LoadedAt:     m.loadedAt,
+		Fallback:     m.fallback,
+		Architecture: m.net.Architecture(),
+		Parameters:   m.net.ParamCount(),
+		SizeBytes:    m.net.SizeBytes(),
+		Preprocess:   m.pipeline.String(),
+	}
+	if !m.net.Meta.IsZero() {
+		meta := m.net.Meta
+		info.Training = &meta
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setModelHeaders(w, m)
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/neural"
+)
+
+func TestHealthz(t *testing.T) {
+	rr := httptest.NewRecorder()
+	healthzHandler(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "ok\n" {
+		t.Errorf("Expected 200 ok, Got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	ready := func() int {
+		rr := httptest.NewRecorder()
+		readyzHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+		return rr.Code
+	}
+
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("With a loaded model: Expected %d, Got %d", http.StatusOK, code)
+	}
+
+	shuttingDown.Store(true)
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("While shutting down: Expected %d, Got %d", http.StatusServiceUnavailable, code)
+	}
+	shuttingDown.Store(false)
+
+	models = newRegistry()
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Without models: Expected %d, Got %d", http.StatusServiceUnavailable, code)
+	}
+
+	// A missing model file leaves a fallback network that is not ready until the file appears
+	path := filepath.Join(t.TempDir(), "model.gob")
+	var logs bytes.Buffer
+	defer captureLog(&logs)()
+	registry, err := loadModels("", path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	models = registry
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("With a fallback network: Expected %d, Got %d", http.StatusServiceUnavailable, code)
+	}
+	if err := neural.NewNetwork(784, 10, 10, 0.1).SaveModel(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := models.Default().Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("After loading the model file: Expected %d, Got %d", http.StatusOK, code)
+	}
+}
+
+func TestLoadModelsRequireModel(t *testing.T) {
+	var logs bytes.Buffer
+	defer captureLog(&logs)()
+	if _, err := loadModels("", filepath.Join(t.TempDir(), "missing.gob"), true); err == nil {
+		t.Error("Expected an error for a missing model file with requireModel")
+	}
+}
+
+func TestModelInfoHandler(t *testing.T) {
+	net := neural.NewNetwork(784, 10, 10, 0.1)
+	net.Meta = neural.Metadata{Epochs: 5, BatchSize: 64, TestAccuracy: 0.97}
+	setTestModel(t, net)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/model", modelInfoHandler)
+	mux.HandleFunc("/models/{name}", modelInfoHandler)
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	for _, path := range []string{"/model", "/models/default"} {
+		rr := get(path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: Expected %d, Got %d", path, http.StatusOK, rr.Code)
+		}
+		var info modelInfo
+		if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+			t.Fatal(err)
+		}
+		if info.Name != "default" || info.Checksum != models.Default().Load().checksum || info.Fallback {
+			t.Errorf("%s: Unexpected identity %+v", path, info)
+		}
+		if info.Architecture.InputSize != 784 || info.Architecture.HiddenSize != 10 || info.Parameters != 784*10+10+10*10+10 {
+			t.Errorf("%s: Unexpected architecture %+v with %d parameters", path, info.Architecture, info.Parameters)
+		}
+		if info.Training == nil || info.Training.Epochs != 5 || info.Training.TestAccuracy != 0.97 {
+			t.Errorf("%s: Expected the training metadata, Got %+v", path, info.Training)
+		}
+	}
+
+	if rr := get("/models/missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("Unknown model: Expected %d, Got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// Models saved without metadata report null training metadata
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	var body map[string]interface{}
+	json.NewDecoder(get("/model").Body).Decode(&body)
+	if v, ok := body["training"]; !ok || v != nil {
+		t.Errorf("Expected \"training\": null, Got %v", v)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/utils"
+)
+
+// requestIDHeader carries the request ID. A valid incoming ID is kept so logs can be correlated across services.
+const requestIDHeader = "X-Request-ID"
+
+var (
+	// debugInput selects how the centered input of /predict is dumped at debug level: "ascii", "png" or "" (disabled).
+	debugInput = ""
+	// debugDir is the directory PNG dumps are written to, named after the request ID.
+	debugDir = "debug_inputs"
+)
+
+type (
+	loggerKey    struct{}
+	requestIDKey struct{}
+)
+
+// requestLogger returns the logger of the request carrying ctx, or the default logger outside a request.
+func requestLogger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// withRequestLogging gives every request an ID, echoed in the X-Request-ID response header,
+// and a logger tagged with it. Each request is logged once it has been served.
+func withRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		r = r.WithContext(context.WithValue(ctx, loggerKey{}, logger))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.Log(r.Context(), level, "request",
+			"method", r.Method, "path", r.URL.Path, "status", rec.status,
+			"duration", time.Since(start), "remote", r.RemoteAddr)
+	})
+}
+
+// validRequestID reports whether id is short and printable enough to be logged and echoed.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random hex digits.
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// dumpInput logs the centered 28x28 input of a request at debug level, as ASCII art or as a PNG
+// written to debugDir, depending on debugInput.
+func dumpInput(ctx context.Context, pixels []float64) {
+	logger := requestLogger(ctx)
+	if debugInput == "" || !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	switch debugInput {
+	case "ascii":
+		logger.DebugContext(ctx, "centered input", "ascii", "\n"+asciiArt(pixels, 28))
+	case "png":
+		if err := os.MkdirAll(debugDir, 0o755); err != nil {
+			logger.WarnContext(ctx, "failed to dump input", "err", err)
+			return
+		}
+		id, _ := ctx.Value(requestIDKey{}).(string)
+		if id == "" {
+			id = newRequestID()
+		}
+		// The ID may come from the client, so keep only characters that are safe in a file name
+		id = strings.Map(func(c rune) rune {
+			if c == '-' || c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+				return c
+			}
+			return '_'
+		}, id)
+		path := filepath.Join(debugDir, fmt.Sprintf("%s_%s.png", time.Now().Format("20060102T150405"), id))
+		if err := utils.SavePNG(path, utils.GrayImage(pixels, 28, 28)); err != nil {
+			logger.WarnContext(ctx, "failed to dump input", "err", err)
+			return
+		}
+		logger.DebugContext(ctx, "centered input", "png", path)
+	}
+}
+
+// asciiArt renders pixels as rows of width characters: '#' for ink, '.' for faint ink and ' ' for background.
+func asciiArt(pixels []float64, width int) string {
+	var b strings.Builder
+	for i, val := range pixels {
+		switch {
+		case val > 0.5:
+			b.WriteByte('#') // Ink
+		case val > 0.1:
+			b.WriteByte('.') // Faint ink
+		default:
+			b.WriteByte(' ') // Background
+		}
+		if (i+1)%width == 0 && i+1 < len(pixels) {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useLogger makes a JSON logger writing to buf at level the default logger for the rest of the test.
+func useLogger(t *testing.T, buf *bytes.Buffer, level slog.Level) {
+	t.Helper()
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+}
+
+func TestWithRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	useLogger(t, &buf, slog.LevelInfo)
+
+	var seen string
+	handler := withRequestLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestLogger(r.Context()).Info("inside")
+		seen, _ = r.Context().Value(requestIDKey{}).(string)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		header string
+		keep   bool
+	}{
+		{"", false},
+		{"abc-123", true},
+		{"has space", false},
+		{strings.Repeat("x", 65), false},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		req := httptest.NewRequest("GET", "/predict", nil)
+		if tt.header != "" {
+			req.Header.Set(requestIDHeader, tt.header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		id := rr.Header().Get(requestIDHeader)
+		if id != seen || id == "" {
+			t.Errorf("Header %q: Expected the handler to see response ID %q, Got %q", tt.header, id, seen)
+		}
+		if kept := id == tt.header; kept != tt.keep {
+			t.Errorf("Header %q: Expected kept=%v, Got ID %q", tt.header, tt.keep, id)
+		}
+
+		// Both the handler's record and the access log carry the request ID
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 log records, Got %d: %q", len(lines), buf.String())
+		}
+		for _, line := range lines {
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatal(err)
+			}
+			if record["request_id"] != id {
+				t.Errorf("Expected request_id %q in %s", id, line)
+			}
+			if record["msg"] == "request" && record["status"] != float64(http.StatusTeapot) {
+				t.Errorf("Expected status %d in the access log, Got %v", http.StatusTeapot, record["status"])
+			}
+		}
+	}
+}
+
+func TestAsciiArt(t *testing.T) {
+	got := asciiArt([]float64{0, 0.2, 0.9, 1, 0.05, 0.3}, 3)
+	if expected := " .#\n# ."; got != expected {
+		t.Errorf("Expected %q, Got %q", expected, got)
+	}
+}
+
+func TestDumpInput(t *testing.T) {
+	defer func(mode, dir string) { debugInput, debugDir = mode, dir }(debugInput, debugDir)
+	debugDir = t.TempDir()
+	pixels := make([]float64, 784)
+	pixels[14*28+14] = 1
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx := context.WithValue(context.WithValue(context.Background(), requestIDKey{}, "../id"), loggerKey{}, logger)
+
+	debugInput = "ascii"
+	dumpInput(ctx, pixels)
+	if !strings.Contains(buf.String(), `"ascii":"\n`) || !strings.Contains(buf.String(), "#") {
+		t.Errorf("Expected an ASCII dump, Got %q", buf.String())
+	}
+
+	buf.Reset()
+	debugInput = "png"
+	dumpInput(ctx, pixels)
+	files, _ := filepath.Glob(filepath.Join(debugDir, "*.png"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], "___id.png") {
+		t.Fatalf("Expected one PNG named after the sanitized request ID, Got %v", files)
+	}
+	if info, err := os.Stat(files[0]); err != nil || info.Size() == 0 {
+		t.Errorf("Expected a non-empty PNG: %v", err)
+	}
+
+	// Nothing is dumped above the debug level
+	buf.Reset()
+	quiet := slog.New(slog.NewJSONHandler(&buf, nil))
+	dumpInput(context.WithValue(ctx, loggerKey{}, quiet), pixels)
+	if buf.Len() != 0 {
+		t.Errorf("Expected no dump at info level, Got %q", buf.String())
+	}
+}
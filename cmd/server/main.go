@@ -1,60 +1,206 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"path/filepath"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/logging"
 	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+	"github.com/coolspeed/go-mnist-scratch/static"
 )
 
 const (
-	modelPath   = "mnist_model.gob"
-	port        = ":8080"
 	inputSize   = 784 // 28x28 pixels
 	hiddenSize  = 200
 	outputSize  = 10 // 0-9 digits
 	learningRate = 0.3 // Only used for NewNetwork if no model is loaded.
 )
 
-var net *neural.Network
+// models holds every served model, each of which can be replaced at runtime by a reload.
+var models = newRegistry()
 
-func init() {
-	// Initialize network (dummy values for NewNetwork, will be overwritten by LoadModel)
-	net = neural.NewNetwork(inputSize, hiddenSize, outputSize, learningRate)
+var (
+	// confidenceThreshold is the top probability below which a prediction is flagged as low confidence.
+	confidenceThreshold = 0.7
+	// topK is the number of most probable labels returned by /predict.
+	topK = 3
+	// maxBodyBytes is the maximum size of a /predict request body.
+	maxBodyBytes int64 = 10 << 20
+	// staticDir overrides the embedded web UI with the files of a directory, for development.
+	staticDir = ""
+)
 
-	// Attempt to load the pre-trained model
-	fmt.Printf("Loading model from %s...\n", modelPath)
-	err := net.LoadModel(modelPath)
+func main() {
+	cfg, err := loadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		fmt.Printf("Warning: Could not load model from %s. Starting with a fresh network. Error: %v\n", modelPath, err)
-		// If model fails to load, the network is already initialized by NewNetwork
-	} else {
-		fmt.Println("Model loaded successfully.")
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := cfg.Log.Setup(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if err := run(ctx, cfg); err != nil {
+		logging.Fatal("server failed", "err", err)
 	}
 }
 
-func main() {
-	http.HandleFunc("/", serveStatic)
-	http.HandleFunc("/predict", predictHandler)
+// run loads the models and serves HTTP until ctx is cancelled, then drains in-flight requests
+// for up to cfg.ShutdownTimeout before it returns.
+func run(ctx context.Context, cfg *config) error {
+	cfg.apply()
 
-	fmt.Printf("Server starting on port %s\n", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	registry, err := loadModels(cfg.ModelDir, cfg.ModelPath, cfg.RequireModel)
+	if err != nil {
+		return fmt.Errorf("error loading models: %w", err)
+	}
+	if cfg.DefaultModel != "" {
+		if err := registry.SetDefault(cfg.DefaultModel); err != nil {
+			return fmt.Errorf("invalid -default-model: %w", err)
+		}
+	}
+	if err := registry.SetSplit(cfg.Split); err != nil {
+		return fmt.Errorf("invalid -ab split: %w", err)
+	}
+	if err := registry.SetShadow(cfg.Shadow); err != nil {
+		return fmt.Errorf("invalid -shadow model: %w", err)
+	}
+	models = registry
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	for _, h := range models.Holders() {
+		if cfg.BatchWindow > 0 {
+			h.batcher = newBatcher((*loadedModel).PredictBatch, cfg.BatchMax, cfg.BatchWindow)
+			defer h.batcher.Close()
+		}
+		// Hot reload on changes of the model file
+		if cfg.WatchInterval > 0 && h.path != "" {
+			go h.Watch(watchCtx, cfg.WatchInterval)
+		}
+	}
+	if cfg.BatchWindow > 0 {
+		slog.Info("batching /predict calls", "window", cfg.BatchWindow, "max", cfg.BatchMax)
+	}
+
+	// Hot reload on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			models.reloadAll("SIGHUP")
+		}
+	}()
+
+	srv := newHTTPServer(cfg, newMux())
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("server starting", "addr", cfg.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Fail readiness, stop accepting connections and wait for in-flight requests; batchers close afterwards (deferred).
+	// Requests still running when the timeout expires then fail with errBatcherClosed and skip the shadow comparison.
+	shuttingDown.Store(true)
+	defer shuttingDown.Store(false)
+	slog.Info("shutting down, draining in-flight requests", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	shutdownErr := srv.Shutdown(shutdownCtx)
+	// Finish the shadow comparisons queued by the drained requests within the same timeout
+	if err := models.CloseShadow(shutdownCtx); err != nil {
+		slog.Warn("shadow comparisons cut off by the shutdown timeout", "err", err)
+	}
+	if shutdownErr != nil {
+		return fmt.Errorf("shutdown: %w", shutdownErr)
+	}
+	slog.Info("server stopped")
+	return nil
+}
+
+// newMux registers every route of the server on a new ServeMux.
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", static.NewHandler(staticDir))
+	mux.HandleFunc("/predict", predictHandler)
+	mux.HandleFunc("/predict/batch", batchPredictHandler)
+	mux.HandleFunc("/models", modelsHandler)
+	mux.HandleFunc("/models/{name}/predict", predictHandler)
+	mux.HandleFunc("/models/{name}/predict/batch", batchPredictHandler)
+	mux.HandleFunc("/admin/reload", adminReloadHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	mux.HandleFunc("/model", modelInfoHandler)
+	mux.HandleFunc("/models/{name}", modelInfoHandler)
+	return mux
 }
 
-func serveStatic(w http.ResponseWriter, r *http.Request) {
-	// Serve index.html for root requests, otherwise static files
-	path := r.URL.Path
-	if path == "/" {
-		path = "/index.html"
+// newHTTPServer wraps handler in the logging, metrics and model header middleware
+// and applies the timeouts of cfg.
+func newHTTPServer(cfg *config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           withRequestLogging(withMetrics(withModelHeaders(handler))),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// loadModels loads every model in modelDir, or the model file at modelPath as "default" if modelDir is empty.
+// Without a model directory the server starts with a fresh network if the model file cannot be loaded,
+// unless requireModel is set. A fresh network keeps /readyz failing until a model file is loaded.
+func loadModels(modelDir, modelPath string, requireModel bool) (*registry, error) {
+	if modelDir != "" {
+		return loadModelDir(modelDir)
+	}
+
+	r := newRegistry()
+	h := newModelHolder("default", modelPath)
+	slog.Info("loading model", "path", modelPath)
+	m, _, err := h.Reload()
+	if err != nil {
+		if requireModel {
+			return nil, err
+		}
+		slog.Warn("could not load model, starting with a fresh network (not ready)", "path", modelPath, "err", err)
+		// Serve a freshly initialized network until a model file can be loaded
+		if err := h.SetFallback(neural.NewNetwork(inputSize, hiddenSize, outputSize, learningRate)); err != nil {
+			return nil, err
+		}
+	} else {
+		slog.Info("model loaded", "model", h.name, "version", m.version, "checksum", m.checksum)
 	}
-	http.ServeFile(w, r, filepath.Join("static", path))
+	r.Add(h)
+	return r, nil
 }
 
 func predictHandler(w http.ResponseWriter, r *http.Request) {
@@ -62,110 +208,135 @@ func predictHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	var requestData struct {
-		Image string `json:"image"` // Base64 encoded or comma-separated string
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&requestData)
+	h, err := models.Route(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Cannot route the request: %v", err), http.StatusNotFound)
 		return
 	}
 
-	// Parse the comma-separated image data string into a float64 slice
-	pixelsStr := strings.Split(requestData.Image, ",")
-	if len(pixelsStr) != inputSize {
-		http.Error(w, fmt.Sprintf("Expected %d pixels, got %d", inputSize, len(pixelsStr)), http.StatusBadRequest)
-		return
-	}
+	parseStart := time.Now()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	var input preprocess.Image
+	if isImageUpload(r) {
+		// PNG or JPEG upload of any size
+		img, err := readUpload(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid upload: %v", err), requestErrorStatus(err))
+			return
+		}
+		input = img
+	} else {
+		var requestData struct {
+			Image string `json:"image"` // Comma-separated string of normalized pixels
+		}
 
-	inputPixels := make([]float64, inputSize)
-	for i, s := range pixelsStr {
-		val, err := strconv.ParseFloat(s, 64)
+		err := json.NewDecoder(r.Body).Decode(&requestData)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid pixel value '%s': %v", s, err), http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), requestErrorStatus(err))
 			return
 		}
-		inputPixels[i] = val // Pixels are expected to be normalized 0.0-1.0
-	}
-
-	inputMatrix := matrix.NewMatrix(1, inputSize)
-	// Apply Center of Mass centering
-	centeredPixels := centerImage(inputPixels)
-	inputMatrix[0] = centeredPixels
-
-	// Debug: Print input image as ASCII art
-	fmt.Println("--- Processed (Centered) Image Input ---")
-	for r := 0; r < 28; r++ {
-		for c := 0; c < 28; c++ {
-			val := centeredPixels[r*28+c]
-			if val > 0.5 {
-				fmt.Print("#") // Ink
-			} else if val > 0.1 {
-				fmt.Print(".") // Faint ink
-			} else {
-				fmt.Print(" ") // Background
-			}
+
+		pixels, err := parsePixels(requestData.Image)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid image: %v", err), http.StatusBadRequest)
+			return
 		}
-		fmt.Println()
+		input = preprocess.New(pixels, preprocess.MNISTSize, preprocess.MNISTSize)
 	}
-	fmt.Println("----------------------------------------")
 
-	// Measure pure inference time
+	serverMetrics.observeStage("parse", time.Since(parseStart))
+
+	// Prepare the input the way the model's training data was prepared, and predict it with the same
+	// snapshot even if a reload happens meanwhile
+	model := h.Load()
+	preprocessStart := time.Now()
+	pixels, err := model.Preprocess(input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid image: %v", err), http.StatusBadRequest)
+		return
+	}
+	serverMetrics.observeStage("preprocess", time.Since(preprocessStart))
+
+	dumpInput(r.Context(), pixels)
+
+	// Measure inference time, including the wait for the batch when batching is enabled
 	startTime := time.Now()
-	prediction, err := net.Predict(inputMatrix)
+	probs, err := h.Predict(r.Context(), model, pixels)
 	inferenceDuration := time.Since(startTime)
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Prediction failed: %v", err), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errBatcherClosed) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, fmt.Sprintf("Prediction failed: %v", err), status)
 		return
 	}
+	serverMetrics.observeStage("inference", inferenceDuration)
+	serverMetrics.observePrediction(model.name, probs)
+	models.CompareShadow(requestLogger(r.Context()), h, []preprocess.Image{input}, [][]float64{probs}, model)
 
-	response := map[string]interface{}{
-		"prediction":  prediction,
-		"duration_us": inferenceDuration.Microseconds(),
-	}
+	response := newPredictResponse(probs, model)
+	response.DurationUS = inferenceDuration.Microseconds()
 	w.Header().Set("Content-Type", "application/json")
+	setModelHeaders(w, model) // The model that answered, even if a reload happened meanwhile
 	json.NewEncoder(w).Encode(response)
 }
 
-// centerImage shifts the image so that its center of mass is at (14, 14).
-func centerImage(pixels []float64) []float64 {
-	sumX, sumY, totalWeight := 0.0, 0.0, 0.0
-	for i, val := range pixels {
-		if val > 0 {
-			x := float64(i % 28)
-			y := float64(i / 28)
-			sumX += x * val
-			sumY += y * val
-			totalWeight += val
-		}
+// requestErrorStatus returns the status code for an error reading the request body:
+// 413 if the body or the uploaded image exceeded its size limit, 400 otherwise.
+func requestErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || errors.Is(err, errImageTooLarge) {
+		return http.StatusRequestEntityTooLarge
 	}
+	return http.StatusBadRequest
+}
 
-	if totalWeight == 0 {
-		return pixels
+// parsePixels parses a comma-separated string of inputSize normalized (0.0-1.0) pixel values.
+func parsePixels(image string) ([]float64, error) {
+	pixelsStr := strings.Split(image, ",")
+	if len(pixelsStr) != inputSize {
+		return nil, fmt.Errorf("expected %d pixels, got %d", inputSize, len(pixelsStr))
 	}
 
-	centerX := sumX / totalWeight
-	centerY := sumY / totalWeight
-
-	shiftX := 14.0 - centerX
-	shiftY := 14.0 - centerY
+	pixels := make([]float64, inputSize)
+	for i, s := range pixelsStr {
+		val, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pixel value '%s': %v", s, err)
+		}
+		pixels[i] = val
+	}
+	return pixels, nil
+}
 
-	newPixels := make([]float64, len(pixels))
-	for r := 0; r < 28; r++ {
-		for c := 0; c < 28; c++ {
-			// Find which source pixel maps to (c, r)
-			// (c, r) = (srcX + shiftX, srcY + shiftY)
-			// => srcX = c - shiftX
-			srcX := int(float64(c) - shiftX)
-			srcY := int(float64(r) - shiftY)
+// predictResponse is the JSON body returned by /predict.
+type predictResponse struct {
+	Prediction    int                 `json:"prediction"`
+	Confidence    float64             `json:"confidence"`    // Probability of the predicted label
+	Probabilities []float64           `json:"probabilities"` // Softmax distribution over all labels
+	TopK          []neural.Prediction `json:"top_k"`         // Most probable labels first
+	Entropy       float64             `json:"entropy"`       // Entropy of the distribution in nats
+	LowConfidence bool                `json:"low_confidence"`
+	DurationUS    int64               `json:"duration_us"`
+	Model         string              `json:"model"` // Name of the model that answered
+	ModelVersion  int64               `json:"model_version"`
+	ModelChecksum string              `json:"model_checksum"`
+}
 
-			if srcX >= 0 && srcX < 28 && srcY >= 0 && srcY < 28 {
-				newPixels[r*28+c] = pixels[srcY*28+srcX]
-			}
-		}
+// newPredictResponse summarizes a softmax distribution of model using the configured top-k and confidence threshold.
+func newPredictResponse(probs []float64, model *loadedModel) *predictResponse {
+	best := neural.TopK(probs, 1)[0]
+	return &predictResponse{
+		Prediction:    best.Label,
+		Confidence:    best.Probability,
+		Probabilities: probs,
+		TopK:          neural.TopK(probs, topK),
+		Entropy:       neural.Entropy(probs),
+		LowConfidence: best.Probability < confidenceThreshold,
+		Model:         model.name,
+		ModelVersion:  model.version,
+		ModelChecksum: model.checksum,
 	}
-	return newPixels
 }
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// latencyBuckets are the upper bounds in seconds of the latency histograms.
+	latencyBuckets = []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+	// confidenceBuckets are the upper bounds of the confidence histogram.
+	confidenceBuckets = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 0.95, 0.99, 1}
+)
+
+// serverMetrics collects the metrics exposed on /metrics.
+var serverMetrics = newMetrics()
+
+// metrics holds every metric of the server. All methods are safe for concurrent use.
+type metrics struct {
+	requests           *counterVec   // By handler pattern and status code
+	requestDuration    *histogramVec // By handler pattern
+	stageDuration      *histogramVec // By stage: parse, preprocess or inference
+	predictions        *counterVec   // By model and predicted class
+	confidence         *histogramVec // By model
+	shadowDisagreement *counterVec   // By served and shadow model
+	shadowDropped      *counterVec   // By served and shadow model
+	start              time.Time
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:           newCounterVec(),
+		requestDuration:    newHistogramVec(latencyBuckets),
+		stageDuration:      newHistogramVec(latencyBuckets),
+		predictions:        newCounterVec(),
+		confidence:         newHistogramVec(confidenceBuckets),
+		shadowDisagreement: newCounterVec(),
+		shadowDropped:      newCounterVec(),
+		start:              time.Now(),
+	}
+}
+
+// observeStage records the duration of one stage of handling a request.
+func (m *metrics) observeStage(stage string, d time.Duration) {
+	m.stageDuration.Observe(d.Seconds(), "stage", stage)
+}
+
+// observePrediction records the predicted class and its confidence for one image predicted by model.
+func (m *metrics) observePrediction(model string, probs []float64) {
+	label, confidence := 0, 0.0
+	for i, p := range probs {
+		if p > confidence {
+			label, confidence = i, p
+		}
+	}
+	m.predictions.Inc("model", model, "class", strconv.Itoa(label))
+	m.confidence.Observe(confidence, "model", model)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format.
+func (m *metrics) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	p := &promWriter{w: bw}
+
+	p.family("mnist_http_requests_total", "counter", "HTTP requests by handler and status code.")
+	m.requests.write(p, "mnist_http_requests_total")
+	p.family("mnist_http_request_duration_seconds", "histogram", "HTTP request latency by handler.")
+	m.requestDuration.write(p, "mnist_http_request_duration_seconds")
+	p.family("mnist_stage_duration_seconds", "histogram", "Latency of the parse, preprocess and inference stages of prediction requests.")
+	m.stageDuration.write(p, "mnist_stage_duration_seconds")
+	p.family("mnist_predictions_total", "counter", "Predicted images by model and predicted class.")
+	m.predictions.write(p, "mnist_predictions_total")
+	p.family("mnist_prediction_confidence", "histogram", "Probability of the predicted class.")
+	m.confidence.write(p, "mnist_prediction_confidence")
+	p.family("mnist_shadow_disagreements_total", "counter", "Images the shadow model predicted differently from the served model.")
+	m.shadowDisagreement.write(p, "mnist_shadow_disagreements_total")
+	p.family("mnist_shadow_dropped_total", "counter", "Requests not compared with the shadow model because the shadow queue was full.")
+	m.shadowDropped.write(p, "mnist_shadow_dropped_total")
+
+	p.family("mnist_model_info", "gauge", "Served models with their version and checksum (always 1).")
+	holders := models.Holders()
+	for _, h := range holders {
+		lm := h.Load()
+		p.sample("mnist_model_info", labelString("model", h.name, "version", strconv.FormatInt(lm.version, 10), "checksum", lm.checksum), 1)
+	}
+	p.family("mnist_model_loaded_timestamp_seconds", "gauge", "Unix time the served version of each model was loaded.")
+	for _, h := range holders {
+		p.sample("mnist_model_loaded_timestamp_seconds", labelString("model", h.name), float64(h.Load().loadedAt.UnixNano())/1e9)
+	}
+
+	writeRuntimeMetrics(p, m.start)
+	if err := bw.Flush(); err != nil {
+		return p.n, err
+	}
+	return p.n, p.err
+}
+
+// writeRuntimeMetrics writes the Go runtime statistics of the process.
+func writeRuntimeMetrics(p *promWriter, start time.Time) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	p.family("go_info", "gauge", "Version of the Go runtime.")
+	p.sample("go_info", labelString("version", runtime.Version()), 1)
+	p.family("go_goroutines", "gauge", "Number of goroutines.")
+	p.sample("go_goroutines", "", float64(runtime.NumGoroutine()))
+	p.family("go_memstats_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	p.sample("go_memstats_alloc_bytes", "", float64(ms.HeapAlloc))
+	p.family("go_memstats_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.")
+	p.sample("go_memstats_heap_inuse_bytes", "", float64(ms.HeapInuse))
+	p.family("go_memstats_sys_bytes", "gauge", "Bytes of memory obtained from the OS.")
+	p.sample("go_memstats_sys_bytes", "", float64(ms.Sys))
+	p.family("go_memstats_mallocs_total", "counter", "Cumulative count of heap objects allocated.")
+	p.sample("go_memstats_mallocs_total", "", float64(ms.Mallocs))
+	p.family("go_gc_cycles_total", "counter", "Number of completed GC cycles.")
+	p.sample("go_gc_cycles_total", "", float64(ms.NumGC))
+	p.family("go_gc_pause_seconds_total", "counter", "Cumulative GC stop-the-world pause time.")
+	p.sample("go_gc_pause_seconds_total", "", float64(ms.PauseTotalNs)/1e9)
+	p.family("process_start_time_seconds", "gauge", "Unix time the server started.")
+	p.sample("process_start_time_seconds", "", float64(start.UnixNano())/1e9)
+}
+
+// metricsHandler serves all metrics in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	serverMetrics.WriteTo(w)
+}
+
+// withMetrics counts every request of next by its route pattern and status code and records its latency.
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// The mux stores the matched pattern in r, which keeps the label set small
+		handler := r.Pattern
+		if handler == "" {
+			handler = "unmatched"
+		}
+		serverMetrics.requests.Inc("handler", handler, "code", strconv.Itoa(rec.status))
+		serverMetrics.requestDuration.Observe(time.Since(start).Seconds(), "handler", handler)
+	})
+}
+
+// statusRecorder remembers the status code written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = code, true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// counterVec is a set of counters keyed by their rendered label set.
+type counterVec struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec() *counterVec {
+	return &counterVec{values: make(map[string]float64)}
+}
+
+// Inc increments the counter with the given label name/value pairs.
+func (c *counterVec) Inc(labels ...string) {
+	key := labelString(labels...)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(p *promWriter, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		p.sample(name, key, c.values[key])
+	}
+}
+
+// histogram counts observations into buckets with fixed upper bounds.
+type histogram struct {
+	counts []uint64 // Per bucket (not cumulative), the last one counting values above all bounds
+	sum    float64
+	count  uint64
+}
+
+// histogramVec is a set of histograms with shared buckets, keyed by their rendered label set.
+type histogramVec struct {
+	mu      sync.Mutex
+	buckets []float64 // Ascending upper bounds
+	values  map[string]*histogram
+}
+
+func newHistogramVec(buckets []float64) *histogramVec {
+	return &histogramVec{buckets: buckets, values: make(map[string]*histogram)}
+}
+
+// Observe adds v to the histogram with the given label name/value pairs.
+func (h *histogramVec) Observe(v float64, labels ...string) {
+	key := labelString(labels...)
+	i := sort.SearchFloat64s(h.buckets, v) // First bucket with an upper bound >= v
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.values[key] = hist
+	}
+	hist.counts[i]++
+	hist.sum += v
+	hist.count++
+}
+
+func (h *histogramVec) write(p *promWriter, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			p.sample(name+"_bucket", withLabel(key, "le", formatFloat(bound)), float64(cumulative))
+		}
+		p.sample(name+"_bucket", withLabel(key, "le", "+Inf"), float64(hist.count))
+		p.sample(name+"_sum", key, hist.sum)
+		p.sample(name+"_count", key, float64(hist.count))
+	}
+}
+
+// promWriter writes samples in the Prometheus text format and keeps the first error.
+type promWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (p *promWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.n += int64(n)
+	p.err = err
+}
+
+// family writes the HELP and TYPE lines of a metric.
+func (p *promWriter) family(name, kind, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one sample; labels is a rendered label set as returned by labelString.
+func (p *promWriter) sample(name, labels string, value float64) {
+	p.printf("%s%s %s\n", name, labels, formatFloat(value))
+}
+
+// labelString renders name/value pairs as a Prometheus label set, e.g. {code="200",handler="/predict"}.
+// It returns an empty string for no labels.
+func labelString(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelEscaper escapes label values as required by the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// withLabel appends one more label to a rendered label set.
+func withLabel(labels, name, value string) string {
+	extra := labelString(name, value)
+	if labels == "" {
+		return extra
+	}
+	return labels[:len(labels)-1] + "," + extra[1:]
+}
+
+// formatFloat formats v the way Prometheus expects, including +Inf, -Inf and NaN.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of m in ascending order, so the output is stable between scrapes.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
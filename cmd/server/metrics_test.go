@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/neural"
+)
+
+func TestLabelString(t *testing.T) {
+	tests := []struct {
+		pairs    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"code", "200"}, `{code="200"}`},
+		{[]string{"a", "1", "b", "2"}, `{a="1",b="2"}`},
+		{[]string{"path", "a\"b\\c\nd"}, `{path="a\"b\\c\nd"}`},
+	}
+	for _, tt := range tests {
+		if got := labelString(tt.pairs...); got != tt.expected {
+			t.Errorf("labelString(%q): Expected %s, Got %s", tt.pairs, tt.expected, got)
+		}
+	}
+
+	if got := withLabel(`{a="1"}`, "le", "0.5"); got != `{a="1",le="0.5"}` {
+		t.Errorf("withLabel: Got %s", got)
+	}
+	if got := withLabel("", "le", "+Inf"); got != `{le="+Inf"}` {
+		t.Errorf("withLabel without labels: Got %s", got)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogramVec([]float64{0.1, 0.5, 1})
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v, "stage", "parse")
+	}
+
+	var buf bytes.Buffer
+	p := &promWriter{w: &buf}
+	h.write(p, "x")
+	expected := `x_bucket{stage="parse",le="0.1"} 2
+x_bucket{stage="parse",le="0.5"} 3
+x_bucket{stage="parse",le="1"} 4
+x_bucket{stage="parse",le="+Inf"} 5
+x_sum{stage="parse"} 3.15
+x_count{stage="parse"} 5
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	defer func(m *metrics) { serverMetrics = m }(serverMetrics)
+	serverMetrics = newMetrics()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/predict", predictHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	handler := withMetrics(mux)
+
+	body, _ := json.Marshal(map[string]string{"image": strings.Repeat("0.0,", 783) + "0.0"})
+	for _, b := range [][]byte{body, body, []byte("not json")} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/predict", bytes.NewReader(b)))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	out := rr.Body.String()
+
+	for _, want := range []string{
+		`mnist_http_requests_total{handler="/predict",code="200"} 2`,
+		`mnist_http_requests_total{handler="/predict",code="400"} 1`,
+		`mnist_http_requests_total{handler="unmatched",code="404"} 1`,
+		`mnist_stage_duration_seconds_count{stage="parse"} 2`,
+		`mnist_stage_duration_seconds_count{stage="preprocess"} 2`,
+		`mnist_stage_duration_seconds_count{stage="inference"} 2`,
+		`mnist_prediction_confidence_count{model="default"} 2`,
+		`mnist_model_info{model="default",version="1",checksum="` + models.Default().Load().checksum + `"} 1`,
+		"# TYPE mnist_predictions_total counter",
+		"go_goroutines ",
+		"go_memstats_alloc_bytes ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Metrics missing %q", want)
+		}
+	}
+
+	// Both predictions of the same blank image land on one class
+	predicted := 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "mnist_predictions_total{") {
+			predicted++
+			if !strings.HasSuffix(line, " 2") {
+				t.Errorf("Expected both predictions in one class, got %q", line)
+			}
+		}
+	}
+	if predicted != 1 {
+		t.Errorf("Expected one predicted class, got %d", predicted)
+	}
+}
+
+func TestStatusRecorder(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rec := &statusRecorder{ResponseWriter: rr, status: http.StatusOK}
+	rec.WriteHeader(http.StatusTeapot)
+	rec.WriteHeader(http.StatusInternalServerError) // Superfluous, ignored like net/http does
+	if rec.status != http.StatusTeapot {
+		t.Errorf("Expected status %d, Got %d", http.StatusTeapot, rec.status)
+	}
+
+	m := newMetrics()
+	m.observeStage("inference", 3*time.Millisecond)
+	if got := m.stageDuration.values[`{stage="inference"}`].count; got != 1 {
+		t.Errorf("Expected one inference observation, Got %d", got)
+	}
+}
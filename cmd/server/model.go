@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+// loadedModel is an immutable snapshot of a network and its identity.
+// Requests take one snapshot and use it throughout, so a reload never changes the model mid-request.
+type loadedModel struct {
+	net      *neural.Network
+	name     string
+	version  int64  // Incremented on every successful (re)load
+	checksum string // Hex SHA-256 prefix of the encoded model
+	loadedAt time.Time
+	fallback bool // Freshly initialized network served because no model file could be loaded
+	// Preprocessing the network was trained with, applied to every input
+	pipeline preprocess.Pipeline
+}
+
+// modelHolder holds the active version of a named model and swaps it atomically on reload.
+type modelHolder struct {
+	name    string
+	path    string
+	current atomic.Pointer[loadedModel]
+	batcher *batcher   // Groups concurrent single-image predictions (nil if disabled)
+	mu      sync.Mutex // Serializes reloads and guards the fields below
+	version int64
+	// Size and modification time of the model file when it was last read
+	fileSize int64
+	fileMod  time.Time
+}
+
+// newModelHolder creates an empty holder for the model called name, stored in the file at path.
+func newModelHolder(name, path string) *modelHolder {
+	return &modelHolder{name: name, path: path}
+}
+
+// Load returns the active model. It is safe for concurrent use.
+func (h *modelHolder) Load() *loadedModel {
+	return h.current.Load()
+}
+
+// Set makes net the active model, identified by the checksum of its gob encoding.
+func (h *modelHolder) Set(net *neural.Network) error {
+	return h.set(net, false)
+}
+
+// SetFallback makes net the active model like Set, but marks it as a fallback,
+// which keeps the server from reporting ready until a model file is loaded.
+func (h *modelHolder) SetFallback(net *neural.Network) error {
+	return h.set(net, true)
+}
+
+func (h *modelHolder) set(net *neural.Network, fallback bool) error {
+	var buf bytes.Buffer
+	if err := net.WriteModel(&buf); err != nil {
+		return err
+	}
+	pipeline, err := modelPipeline(h.name, net)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.swap(net, pipeline, buf.Bytes(), fallback)
+	return nil
+}
+
+// Reload reads the model file and makes it the active model. If the file is unchanged
+// the active model is kept and reloaded is false. On error the active model is kept as well.
+func (h *modelHolder) Reload() (m *loadedModel, reloaded bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if info, err := os.Stat(h.path); err == nil {
+		h.fileSize, h.fileMod = info.Size(), info.ModTime()
+	}
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return h.Load(), false, fmt.Errorf("failed to read model: %w", err)
+	}
+	if current := h.Load(); current != nil && current.checksum == checksum(data) {
+		return current, false, nil
+	}
+
+	net := neural.NewNetwork(inputSize, hiddenSize, outputSize, learningRate)
+	if err := net.ReadModel(bytes.NewReader(data)); err != nil {
+		return h.Load(), false, err
+	}
+	pipeline, err := modelPipeline(h.name, net)
+	if err != nil {
+		return h.Load(), false, err
+	}
+	return h.swap(net, pipeline, data, false), true, nil
+}
+
+// legacyPipeline is applied to models saved without a pipeline, which were trained on the raw MNIST digits.
+// It is what the server did before pipelines were recorded: center-of-mass alignment only.
+var legacyPipeline = preprocess.Pipeline{preprocess.CenterOfMass{}}
+
+// modelPipeline returns the preprocessing pipeline recorded in the metadata of net, the model called name,
+// or legacyPipeline with a warning for models saved without one.
+func modelPipeline(name string, net *neural.Network) (preprocess.Pipeline, error) {
+	if net.Meta.Preprocess == "" {
+		slog.Warn("model has no recorded preprocessing pipeline, applying the legacy preprocessing", "model", name, "pipeline", legacyPipeline.String())
+		return legacyPipeline, nil
+	}
+	return preprocess.Parse(net.Meta.Preprocess)
+}
+
+// Preprocess runs img through the preprocessing pipeline of m and returns the input of its network.
+func (m *loadedModel) Preprocess(img preprocess.Image) ([]float64, error) {
+	pipeline := m.pipeline
+	rawDigits := m.net.Meta.Preprocess == "" || len(m.pipeline) == 0 // Trained on the MNIST digits as published
+	if rawDigits && (img.Rows != preprocess.MNISTSize || img.Cols != preprocess.MNISTSize) {
+		// Uploads get the original MNIST preparation of those digits, as before pipelines were recorded
+		pipeline = preprocess.Default()
+	}
+	out := pipeline.Apply(img)
+	if len(out.Pixels) != inputSize {
+		return nil, fmt.Errorf("preprocessing %q turns a %dx%d image into %dx%d, expected 28x28", pipeline, img.Cols, img.Rows, out.Cols, out.Rows)
+	}
+	return out.Pixels, nil
+}
+
+// Predict returns the class probabilities of a single image computed by m, a snapshot of h.
+// It goes through the batcher if batching is enabled.
+func (h *modelHolder) Predict(ctx context.Context, m *loadedModel, pixels []float64) ([]float64, error) {
+	if h.batcher != nil {
+		return h.batcher.Predict(ctx, m, pixels)
+	}
+	return m.net.PredictProba(matrix.Matrix{pixels})
+}
+
+// PredictBatch predicts every row of inputs with m.
+func (m *loadedModel) PredictBatch(inputs matrix.Matrix) ([][]float64, error) {
+	return m.net.PredictProbaBatch(inputs)
+}
+
+// swap publishes a new snapshot. The caller must hold h.mu.
+func (h *modelHolder) swap(net *neural.Network, pipeline preprocess.Pipeline, encoded []byte, fallback bool) *loadedModel {
+	h.version++
+	m := &loadedModel{
+		net:      net,
+		name:     h.name,
+		version:  h.version,
+		checksum: checksum(encoded),
+		loadedAt: time.Now(),
+		fallback: fallback,
+		pipeline: pipeline,
+	}
+	h.current.Store(m)
+	return m
+}
+
+// Watch polls the model file every interval and reloads it when its size or modification time
+// differs from the file that was last read. It returns when ctx is cancelled.
+func (h *modelHolder) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if h.fileChanged() {
+			h.logReload("file change")
+		}
+	}
+}
+
+// fileChanged reports whether the model file differs in size or modification time from the file last read.
+func (h *modelHolder) fileChanged() bool {
+	info, err := os.Stat(h.path)
+	if err != nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return info.Size() != h.fileSize || !info.ModTime().Equal(h.fileMod)
+}
+
+// logReload reloads the model and logs the outcome, naming the trigger of the reload.
+func (h *modelHolder) logReload(trigger string) {
+	m, reloaded, err := h.Reload()
+	switch {
+	case err != nil:
+		slog.Error("model reload failed, keeping the active model", "model", h.name, "trigger", trigger, "err", err)
+	case reloaded:
+		slog.Info("model reloaded", "model", h.name, "trigger", trigger, "version", m.version, "checksum", m.checksum)
+	default:
+		slog.Info("model unchanged", "model", h.name, "trigger", trigger, "version", m.version, "checksum", m.checksum)
+	}
+}
+
+// checksum returns the first 12 hex digits of the SHA-256 of data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+func TestModelHolderReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.gob")
+	h := newModelHolder("test", path)
+
+	if _, _, err := h.Reload(); err == nil {
+		t.Error("Reload should fail while the model file does not exist")
+	}
+
+	if err := neural.NewNetwork(784, 10, 10, 0.1).SaveModel(path); err != nil {
+		t.Fatal(err)
+	}
+	first, reloaded, err := h.Reload()
+	if err != nil || !reloaded {
+		t.Fatalf("Expected the first reload to load the model, got reloaded=%v, err=%v", reloaded, err)
+	}
+	if first.version != 1 || len(first.checksum) != 12 {
+		t.Errorf("Expected version 1 with a 12 digit checksum, got %d (%q)", first.version, first.checksum)
+	}
+
+	// An unchanged file keeps the active model
+	same, reloaded, err := h.Reload()
+	if err != nil || reloaded || same != first {
+		t.Errorf("Reloading an unchanged file should keep the model, got reloaded=%v, err=%v", reloaded, err)
+	}
+
+	// A corrupt file keeps the active model as well
+	if err := os.WriteFile(path, []byte("not a model"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := h.Reload(); err == nil {
+		t.Error("Reload should fail for a corrupt model file")
+	}
+	if h.Load() != first {
+		t.Error("A failed reload must not replace the active model")
+	}
+
+	if err := neural.NewNetwork(784, 10, 10, 0.1).SaveModel(path); err != nil {
+		t.Fatal(err)
+	}
+	second, reloaded, err := h.Reload()
+	if err != nil || !reloaded {
+		t.Fatalf("Expected a changed file to be reloaded, got reloaded=%v, err=%v", reloaded, err)
+	}
+	if second.version != 2 || second.checksum == first.checksum {
+		t.Errorf("Expected version 2 with a new checksum, got %d (%s, previously %s)", second.version, second.checksum, first.checksum)
+	}
+}
+
+func TestModelHolderWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.gob")
+	if err := neural.NewNetwork(784, 10, 10, 0.1).SaveModel(path); err != nil {
+		t.Fatal(err)
+	}
+	h := newModelHolder("test", path)
+	if _, _, err := h.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Watch(ctx, 5*time.Millisecond)
+
+	// A model with a different size is detected even if the modification time does not change
+	if err := neural.NewNetwork(784, 12, 10, 0.1).SaveModel(path); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for h.Load().version < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not reload the changed model file")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := len(h.Load().net.W1[0]); got != 12 {
+		t.Errorf("Expected the reloaded model to have 12 hidden units, got %d", got)
+	}
+}
+
+func TestModelHolderConcurrentReload(t *testing.T) {
+	h := newModelHolder("test", "")
+	if err := h.Set(neural.NewNetwork(784, 10, 10, 0.1)); err != nil {
+		t.Fatal(err)
+	}
+	input := matrix.NewMatrix(1, 784)
+
+	// Swapping models while predictions run must be race free (go test -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := h.Load().net.PredictProba(input); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := h.Set(neural.NewNetwork(784, 10, 10, 0.1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if v := h.Load().version; v != 11 {
+		t.Errorf("Expected version 11 after 11 swaps, got %d", v)
+	}
+}
+
+func TestAdminReloadHandler(t *testing.T) {
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	defer func(token string) { adminToken = token }(adminToken)
+
+	serve := func(method, token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "/admin/reload", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		withModelHeaders(http.HandlerFunc(adminReloadHandler)).ServeHTTP(rr, req)
+		return rr
+	}
+
+	adminToken = ""
+	if rr := serve("POST", "anything"); rr.Code != http.StatusNotFound {
+		t.Errorf("Without a configured token: got status %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	adminToken = "secret"
+	if rr := serve("POST", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Without a token: got status %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := serve("POST", "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("With a wrong token: got status %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := serve("GET", "secret"); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("With GET: got status %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+
+	// The test has no model file, so an authorized reload fails but keeps the model
+	rr := serve("POST", "secret")
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Reload without a model file: got status %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if rr.Header().Get("X-Model-Checksum") != models.Default().Load().checksum {
+		t.Errorf("Expected X-Model-Checksum %q, got %q", models.Default().Load().checksum, rr.Header().Get("X-Model-Checksum"))
+	}
+}
+
+func TestModelPipeline(t *testing.T) {
+	// Models saved without a pipeline were trained on raw digits and only get center-of-mass alignment,
+	// except for uploads of other sizes, which get the original MNIST preparation
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	legacy := models.Default().Load()
+	if got, want := legacy.pipeline.String(), "com"; got != want {
+		t.Errorf("Expected the legacy pipeline %q, Got %q", want, got)
+	}
+	raw := make([]float64, 784)
+	raw[0] = 1
+	if input, err := legacy.Preprocess(preprocess.New(raw, 28, 28)); err != nil || input[0] == 1 {
+		t.Errorf("Expected a 28x28 input to be aligned by center of mass, Got %v (%v)", input[:3], err)
+	}
+	if _, err := legacy.Preprocess(preprocess.FromImage(testDigit())); err != nil {
+		t.Errorf("Expected an upload to be resized to 28x28, Got %v", err)
+	}
+
+	// The pipeline recorded in the metadata is applied to every input
+	net := neural.NewNetwork(784, 10, 10, 0.1)
+	net.Meta.Preprocess = "threshold=0.5"
+	setTestModel(t, net)
+	pixels := make([]float64, 784)
+	pixels[0], pixels[1] = 0.3, 0.8
+	input, err := models.Default().Load().Preprocess(preprocess.New(pixels, 28, 28))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input[0] != 0 || input[1] != 0.8 {
+		t.Errorf("Expected the threshold to zero only the faint pixel, Got %v, %v", input[0], input[1])
+	}
+
+	// A pipeline without resizing steps cannot turn an upload into a 28x28 input
+	net.Meta.Preprocess = "com"
+	setTestModel(t, net)
+	var upload bytes.Buffer
+	if err := png.Encode(&upload, testDigit()); err != nil {
+		t.Fatal(err)
+	}
+	if rr := servePredict(t, &upload, "image/png"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an upload the pipeline cannot resize, Got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// Models trained on the digits as published get uploads in the original MNIST preparation
+	net.Meta.Preprocess = "none"
+	setTestModel(t, net)
+	if err := png.Encode(&upload, testDigit()); err != nil {
+		t.Fatal(err)
+	}
+	if rr := servePredict(t, &upload, "image/png"); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d for an upload to a model without preprocessing, Got %d", http.StatusOK, rr.Code)
+	}
+
+	net.Meta.Preprocess = "sharpen"
+	if err := newModelHolder("broken", "").Set(net); err == nil {
+		t.Error("Expected an error for a model with an unknown preprocessing step")
+	}
+}
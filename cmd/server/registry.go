@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+// modelHeader selects a model by name when the request path does not.
+const modelHeader = "X-Model"
+
+// shadowQueueSize is the number of requests that may wait for the shadow worker.
+// Requests arriving while the queue is full are not compared, so shadowing cannot pile up work.
+var shadowQueueSize = 256
+
+// registry holds every model served by the server and decides which one answers a request.
+type registry struct {
+	mu          sync.RWMutex
+	holders     map[string]*modelHolder
+	defaultName string
+	split       []splitRoute // Weighted A/B split of requests that name no model
+	shadow      string       // Candidate model scoring requests in the background (empty if disabled)
+
+	shadowMu     sync.Mutex     // Guards the shadow worker fields below
+	shadowJobs   chan shadowJob // Comparisons waiting for the shadow worker (nil until the first comparison)
+	shadowDone   chan struct{}  // Closed when the worker has run every queued comparison
+	shadowClosed bool           // Set by CloseShadow; later comparisons are dropped
+}
+
+// shadowJob is a request waiting to be compared with the shadow model.
+type shadowJob struct {
+	logger   *slog.Logger
+	shadow   *modelHolder
+	images   []preprocess.Image // Raw request images, before any preprocessing
+	served   [][]float64
+	servedBy *loadedModel
+}
+
+// splitRoute is the share of unrouted traffic sent to one model.
+type splitRoute struct {
+	name   string
+	weight float64
+}
+
+// newRegistry creates an empty registry.
+func newRegistry() *registry {
+	return &registry{holders: make(map[string]*modelHolder)}
+}
+
+// loadModelDir creates a registry with one model per *.gob file in dir, named after the file.
+// Files that fail to load are skipped with a warning.
+func loadModelDir(dir string) (*registry, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.gob"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := newRegistry()
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".gob")
+		h := newModelHolder(name, path)
+		m, _, err := h.Reload()
+		if err != nil {
+			slog.Warn("skipping model", "path", path, "err", err)
+			continue
+		}
+		slog.Info("model loaded", "model", name, "path", path, "version", m.version, "checksum", m.checksum)
+		r.Add(h)
+	}
+	if len(r.holders) == 0 {
+		return nil, fmt.Errorf("no loadable *.gob models in %s", dir)
+	}
+	return r, nil
+}
+
+// Add registers h under its name. The first model added becomes the default.
+func (r *registry) Add(h *modelHolder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.holders[h.name] = h
+	if r.defaultName == "" {
+		r.defaultName = h.name
+	}
+}
+
+// Get returns the model called name.
+func (r *registry) Get(name string) (*modelHolder, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.holders[name]
+	return h, ok
+}
+
+// Default returns the model answering requests that name no model and match no A/B split.
+func (r *registry) Default() *modelHolder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.holders[r.defaultName]
+}
+
+// Holders returns all models sorted by name.
+func (r *registry) Holders() []*modelHolder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	holders := make([]*modelHolder, 0, len(r.holders))
+	for _, h := range r.holders {
+		holders = append(holders, h)
+	}
+	sort.Slice(holders, func(i, j int) bool { return holders[i].name < holders[j].name })
+	return holders
+}
+
+// SetDefault makes the model called name the default.
+func (r *registry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.holders[name]; !ok {
+		return fmt.Errorf("unknown model %q", name)
+	}
+	r.defaultName = name
+	return nil
+}
+
+// SetSplit splits requests that name no model between models by weight,
+// given as "name=weight,name=weight". An empty spec sends them all to the default model.
+func (r *registry) SetSplit(spec string) error {
+	var split []splitRoute
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, weightStr, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("invalid split %q (expected name=weight)", part)
+		}
+		weight, err := strconv.ParseFloat(weightStr, 64)
+		if err != nil || weight < 0 {
+			return fmt.Errorf("invalid weight in split %q", part)
+		}
+		if _, ok := r.Get(name); !ok {
+			return fmt.Errorf("unknown model %q in split", name)
+		}
+		split = append(split, splitRoute{name: name, weight: weight})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.split = split
+	return nil
+}
+
+// SetShadow makes the model called name score every request in the background (empty to disable).
+func (r *registry) SetShadow(name string) error {
+	if _, ok := r.Get(name); name != "" && !ok {
+		return fmt.Errorf("unknown shadow model %q", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shadow = name
+	return nil
+}
+
+// Route returns the model that answers req: the model named in the path (/models/{name}/...),
+// else the one named by the X-Model header, else one drawn from the A/B split, else the default.
+func (r *registry) Route(req *http.Request) (*modelHolder, error) {
+	name := req.PathValue("name")
+	if name == "" {
+		name = req.Header.Get(modelHeader)
+	}
+	if name != "" {
+		h, ok := r.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown model %q", name)
+		}
+		return h, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	total := 0.0
+	for _, route := range r.split {
+		total += route.weight
+	}
+	if total > 0 {
+		x := rand.Float64() * total
+		for _, route := range r.split {
+			if x < route.weight {
+				return r.holders[route.name], nil
+			}
+			x -= route.weight
+		}
+	}
+	return r.holders[r.defaultName], nil
+}
+
+// Shadow returns the shadow model for a request answered by served, or nil if there is none.
+func (r *registry) Shadow(served *modelHolder) *modelHolder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.shadow == "" || r.shadow == served.name {
+		return nil
+	}
+	return r.holders[r.shadow]
+}
+
+// CompareShadow queues the images of a request answered by servedBy, a snapshot of served, for comparison
+// with the shadow model. A single worker runs the comparisons in the background; if its queue is full,
+// the request is dropped from the comparison and counted, as it is after CloseShadow.
+// It does nothing if served has no shadow.
+func (r *registry) CompareShadow(logger *slog.Logger, served *modelHolder, images []preprocess.Image, probs [][]float64, servedBy *loadedModel) {
+	shadow := r.Shadow(served)
+	if shadow == nil {
+		return
+	}
+
+	r.shadowMu.Lock()
+	defer r.shadowMu.Unlock()
+	if !r.shadowClosed && r.shadowJobs == nil {
+		r.shadowJobs = make(chan shadowJob, shadowQueueSize)
+		r.shadowDone = make(chan struct{})
+		go func(jobs <-chan shadowJob, done chan<- struct{}) {
+			defer close(done)
+			for job := range jobs {
+				shadowCompare(job.logger, job.shadow, job.images, job.served, job.servedBy)
+			}
+		}(r.shadowJobs, r.shadowDone)
+	}
+
+	if !r.shadowClosed {
+		select {
+		case r.shadowJobs <- shadowJob{logger: logger, shadow: shadow, images: images, served: probs, servedBy: servedBy}:
+			return
+		default:
+		}
+	}
+	serverMetrics.shadowDropped.Inc("model", servedBy.name, "shadow", shadow.name)
+	logger.Debug("shadow comparison dropped", "shadow", shadow.name, "closed", r.shadowClosed)
+}
+
+// CloseShadow stops accepting shadow comparisons and waits until the worker has run the queued ones,
+// or until ctx is done.
+func (r *registry) CloseShadow(ctx context.Context) error {
+	r.shadowMu.Lock()
+	if !r.shadowClosed && r.shadowJobs != nil {
+		close(r.shadowJobs)
+	}
+	r.shadowClosed = true
+	done := r.shadowDone
+	r.shadowMu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shadowCompare scores the raw images with the shadow model, through the shadow's own preprocessing
+// pipeline, and logs every image whose predicted label differs from the served prediction to logger.
+func shadowCompare(logger *slog.Logger, shadow *modelHolder, images []preprocess.Image, served [][]float64, servedBy *loadedModel) {
+	model := shadow.Load()
+	inputs := make(matrix.Matrix, len(images))
+	for i, img := range images {
+		pixels, err := model.Preprocess(img)
+		if err != nil {
+			logger.Error("shadow model failed", "shadow", shadow.name, "image", i, "err", err)
+			return
+		}
+		inputs[i] = pixels
+	}
+	probs, err := model.PredictBatch(inputs)
+	if err != nil {
+		logger.Error("shadow model failed", "shadow", shadow.name, "err", err)
+		return
+	}
+	for i := range probs {
+		want := neural.TopK(served[i], 1)[0].Label
+		got := neural.TopK(probs[i], 1)[0].Label
+		if want != got {
+			serverMetrics.shadowDisagreement.Inc("model", servedBy.name, "shadow", model.name)
+			logger.Warn("shadow disagreement", "image", i,
+				slog.Group("served", "model", servedBy.name, "version", servedBy.version, "checksum", servedBy.checksum,
+					"label", want, "probability", served[i][want]),
+				slog.Group("shadow", "model", model.name, "version", model.version, "checksum", model.checksum,
+					"label", got, "probability", probs[i][got]))
+		}
+	}
+}
+
+// reloadAll reloads every model and logs the outcome, naming the trigger of the reload.
+func (r *registry) reloadAll(trigger string) {
+	for _, h := range r.Holders() {
+		h.logReload(trigger)
+	}
+}
+
+// modelsHandler lists the served models and the routing configuration.
+func modelsHandler(w http.ResponseWriter, r *http.Request) {
+	type modelEntry struct {
+		Name     string `json:"name"`
+		Version  int64  `json:"version"`
+		Checksum string `json:"checksum"`
+		Path     string `json:"path,omitempty"`
+	}
+	var list []modelEntry
+	for _, h := range models.Holders() {
+		m := h.Load()
+		list = append(list, modelEntry{Name: h.name, Version: m.version, Checksum: m.checksum, Path: h.path})
+	}
+
+	models.mu.RLock()
+	split := make(map[string]float64, len(models.split))
+	for _, route := range models.split {
+		split[route.name] = route.weight
+	}
+	response := map[string]interface{}{
+		"models":  list,
+		"default": models.defaultName,
+		"split":   split,
+		"shadow":  models.shadow,
+	}
+	models.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
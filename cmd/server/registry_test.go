@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+// newTestRegistry creates a registry serving a fresh network under each name.
+func newTestRegistry(t *testing.T, names ...string) *registry {
+	t.Helper()
+	r := newRegistry()
+	for _, name := range names {
+		h := newModelHolder(name, "")
+		if err := h.Set(neural.NewNetwork(784, 10, 10, 0.1)); err != nil {
+			t.Fatal(err)
+		}
+		r.Add(h)
+	}
+	return r
+}
+
+// captureLog redirects the standard logger to w and returns a function restoring it.
+func captureLog(w io.Writer) func() {
+	flags := log.Flags()
+	log.SetOutput(w)
+	log.SetFlags(0)
+	return func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}
+}
+
+func TestRegistryRoute(t *testing.T) {
+	r := newTestRegistry(t, "prod", "candidate")
+
+	route := func(path, header string) (string, error) {
+		req := httptest.NewRequest("POST", "/predict", nil)
+		if path != "" {
+			req.SetPathValue("name", path)
+		}
+		if header != "" {
+			req.Header.Set(modelHeader, header)
+		}
+		h, err := r.Route(req)
+		if err != nil {
+			return "", err
+		}
+		return h.name, nil
+	}
+
+	tests := []struct {
+		path, header, expected string
+	}{
+		{"", "", "prod"},
+		{"candidate", "", "candidate"},
+		{"", "candidate", "candidate"},
+		{"prod", "candidate", "prod"}, // The path wins over the header
+	}
+	for _, tt := range tests {
+		got, err := route(tt.path, tt.header)
+		if err != nil || got != tt.expected {
+			t.Errorf("Route(path=%q, header=%q): Expected %s, Got %s (%v)", tt.path, tt.header, tt.expected, got, err)
+		}
+	}
+	if _, err := route("missing", ""); err == nil {
+		t.Error("Routing to an unknown model should fail")
+	}
+
+	if err := r.SetSplit("prod=0,candidate=1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if got, _ := route("", ""); got != "candidate" {
+			t.Fatalf("A split of 0/1 should always pick candidate, got %s", got)
+		}
+	}
+	if got, _ := route("", "prod"); got != "prod" {
+		t.Errorf("A named model should bypass the split, got %s", got)
+	}
+}
+
+func TestRegistrySplitWeights(t *testing.T) {
+	r := newTestRegistry(t, "a", "b")
+	if err := r.SetSplit("a=75, b=25"); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	const n = 4000
+	for i := 0; i < n; i++ {
+		h, err := r.Route(httptest.NewRequest("POST", "/predict", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[h.name]++
+	}
+	if share := float64(counts["a"]) / n; share < 0.7 || share > 0.8 {
+		t.Errorf("Expected about 75%% of requests on a, got %.1f%%", share*100)
+	}
+}
+
+func TestRegistryConfigErrors(t *testing.T) {
+	r := newTestRegistry(t, "a")
+	for _, spec := range []string{"a", "a=x", "a=-1", "b=1"} {
+		if err := r.SetSplit(spec); err == nil {
+			t.Errorf("SetSplit(%q) should fail", spec)
+		}
+	}
+	if err := r.SetDefault("b"); err == nil {
+		t.Error("SetDefault with an unknown model should fail")
+	}
+	if err := r.SetShadow("b"); err == nil {
+		t.Error("SetShadow with an unknown model should fail")
+	}
+}
+
+func TestRegistryShadow(t *testing.T) {
+	r := newTestRegistry(t, "prod", "candidate")
+	prod, _ := r.Get("prod")
+	candidate, _ := r.Get("candidate")
+
+	if r.Shadow(prod) != nil {
+		t.Error("Expected no shadow model before SetShadow")
+	}
+	if err := r.SetShadow("candidate"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Shadow(prod) != candidate {
+		t.Error("Expected candidate to shadow prod")
+	}
+	if r.Shadow(candidate) != nil {
+		t.Error("A model must not shadow itself")
+	}
+}
+
+func TestShadowCompareLogsDisagreements(t *testing.T) {
+	r := newTestRegistry(t, "prod", "candidate")
+	candidate, _ := r.Get("candidate")
+
+	// The shadow receives the raw upload and prepares it with its own pipeline
+	images := []preprocess.Image{preprocess.FromImage(testDigit())}
+	model := candidate.Load()
+	input, err := model.Preprocess(images[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	probs, err := model.PredictBatch([][]float64{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	label := neural.TopK(probs[0], 1)[0].Label
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	// Served probabilities equal to the shadow's own agree
+	shadowCompare(logger, candidate, images, probs, model)
+	if buf.Len() != 0 {
+		t.Errorf("Expected no log for an agreeing prediction, got %q", buf.String())
+	}
+
+	// A served prediction of another label disagrees
+	other := make([]float64, 10)
+	other[(label+1)%10] = 1
+	shadowCompare(logger, candidate, images, [][]float64{other}, &loadedModel{name: "prod", version: 1})
+	if !strings.Contains(buf.String(), `msg="shadow disagreement"`) || !strings.Contains(buf.String(), "served.model=prod") {
+		t.Errorf("Expected a disagreement to be logged, got %q", buf.String())
+	}
+
+	// A shadow whose pipeline cannot resize the upload fails, whatever the served model did with it
+	net := neural.NewNetwork(784, 10, 10, 0.1)
+	net.Meta.Preprocess = "com"
+	if err := candidate.Set(net); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	shadowCompare(logger, candidate, images, probs, model)
+	if !strings.Contains(buf.String(), `msg="shadow model failed"`) {
+		t.Errorf("Expected the shadow's own pipeline to reject the upload, got %q", buf.String())
+	}
+}
+
+func TestCompareShadowDropsWhenQueueFull(t *testing.T) {
+	r := newTestRegistry(t, "prod", "candidate")
+	prod, _ := r.Get("prod")
+	if err := r.SetShadow("candidate"); err != nil {
+		t.Fatal(err)
+	}
+	// A queue of one without a worker, so the queue stays full
+	r.shadowJobs = make(chan shadowJob, 1)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	images := []preprocess.Image{preprocess.New(make([]float64, 784), 28, 28)}
+	probs := [][]float64{make([]float64, 10)}
+	model := prod.Load()
+	key := labelString("model", "prod", "shadow", "candidate")
+	before := serverMetrics.shadowDropped.values[key]
+
+	r.CompareShadow(logger, prod, images, probs, model)
+	r.CompareShadow(logger, prod, images, probs, model)
+	if len(r.shadowJobs) != 1 {
+		t.Errorf("Expected one queued comparison, Got %d", len(r.shadowJobs))
+	}
+	if got := serverMetrics.shadowDropped.values[key] - before; got != 1 {
+		t.Errorf("Expected one dropped comparison, Got %v", got)
+	}
+
+	// Requests answered by the shadow itself are not compared
+	candidate, _ := r.Get("candidate")
+	r.CompareShadow(logger, candidate, images, probs, candidate.Load())
+	if got := serverMetrics.shadowDropped.values[key] - before; got != 1 || len(r.shadowJobs) != 1 {
+		t.Errorf("Expected no comparison for the shadow's own requests, Got %v dropped", got)
+	}
+}
+
+func TestCloseShadowRunsQueuedComparisons(t *testing.T) {
+	r := newTestRegistry(t, "prod", "candidate")
+	prod, _ := r.Get("prod")
+	if err := r.SetShadow("candidate"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	images := []preprocess.Image{preprocess.New(make([]float64, 784), 28, 28)}
+	model := prod.Load()
+	// The served model predicted another label than the shadow, which the worker logs
+	candidate, _ := r.Get("candidate")
+	shadowInput, _ := candidate.Load().Preprocess(images[0])
+	shadowProbs, _ := candidate.Load().PredictBatch([][]float64{shadowInput})
+	served := make([]float64, 10)
+	served[(neural.TopK(shadowProbs[0], 1)[0].Label+1)%10] = 1
+
+	r.CompareShadow(logger, prod, images, [][]float64{served}, model)
+	if err := r.CloseShadow(context.Background()); err != nil {
+		t.Fatalf("CloseShadow returned an unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `msg="shadow disagreement"`) {
+		t.Errorf("Expected the queued comparison to run before CloseShadow returns, got %q", buf.String())
+	}
+
+	// Comparisons after the close are dropped instead of sent on the closed queue
+	r.CompareShadow(logger, prod, images, [][]float64{served}, model)
+	if err := r.CloseShadow(context.Background()); err != nil {
+		t.Errorf("A second CloseShadow returned an unexpected error: %v", err)
+	}
+}
+
+func TestLoadModelDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b", "a"} {
+		if err := neural.NewNetwork(784, 10, 10, 0.1).SaveModel(filepath.Join(dir, name+".gob")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.gob"), []byte("not a model"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	defer captureLog(&buf)()
+	r, err := loadModelDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, h := range r.Holders() {
+		names = append(names, h.name)
+	}
+	if strings.Join(names, ",") != "a,b" {
+		t.Errorf("Expected models a,b (broken skipped), got %v", names)
+	}
+
+	if _, err := loadModelDir(t.TempDir()); err == nil {
+		t.Error("Loading an empty model directory should fail")
+	}
+}
+
+func TestModelPathRouting(t *testing.T) {
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	candidate := newModelHolder("candidate", "")
+	if err := candidate.Set(neural.NewNetwork(784, 10, 10, 0.1)); err != nil {
+		t.Fatal(err)
+	}
+	models.Add(candidate)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/predict", predictHandler)
+	mux.HandleFunc("/models/{name}/predict", predictHandler)
+	mux.HandleFunc("/models", modelsHandler)
+
+	body, _ := json.Marshal(map[string]string{"image": strings.Repeat("0.0,", 783) + "0.0"})
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		return rr
+	}
+
+	for path, expected := range map[string]string{"/predict": "default", "/models/candidate/predict": "candidate"} {
+		rr := serve(path)
+		var response predictResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: Failed to decode response: %v", path, err)
+		}
+		if response.Model != expected || rr.Header().Get("X-Model-Name") != expected {
+			t.Errorf("%s: Expected model %s, Got %s (header %q)", path, expected, response.Model, rr.Header().Get("X-Model-Name"))
+		}
+	}
+	if rr := serve("/models/missing/predict"); rr.Code != http.StatusNotFound {
+		t.Errorf("Unknown model: got status %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/models", nil))
+	var listing struct {
+		Models  []struct{ Name string } `json:"models"`
+		Default string                  `json:"default"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing.Models) != 2 || listing.Default != "default" {
+		t.Errorf("Expected 2 models with default \"default\", got %+v", listing)
+	}
+}
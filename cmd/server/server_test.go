@@ -11,10 +11,21 @@ import (
 	"github.com/coolspeed/go-mnist-scratch/neural"
 )
 
+// setTestModel makes net the only model of the server, served as "default".
+func setTestModel(t *testing.T, net *neural.Network) {
+	t.Helper()
+	h := newModelHolder("default", "")
+	if err := h.Set(net); err != nil {
+		t.Fatalf("Failed to set model: %v", err)
+	}
+	models = newRegistry()
+	models.Add(h)
+}
+
 func TestPredictHandler(t *testing.T) {
-	// Initialize the global network variable for testing
+	// Initialize the active model for testing
 	// We use a small dummy network to avoid loading large model files during unit tests
-	net = neural.NewNetwork(784, 10, 10, 0.1)
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
 
 	// Create a dummy 28x28 image (comma-separated string of 784 zeros)
 	dummyImage := strings.Repeat("0.0,", 783) + "0.0"
@@ -49,6 +60,24 @@ func TestPredictHandler(t *testing.T) {
 		t.Error("Response missing 'prediction' field")
 	}
 
+	// Verify 'confidence' is a probability
+	if confidence, ok := response["confidence"].(float64); !ok || confidence < 0 || confidence > 1 {
+		t.Errorf("Response 'confidence' should be a probability, got %v", response["confidence"])
+	}
+
+	// Verify the full distribution and the top-k labels
+	if probs, ok := response["probabilities"].([]interface{}); !ok || len(probs) != 10 {
+		t.Errorf("Response 'probabilities' should hold 10 values, got %v", response["probabilities"])
+	}
+	if top, ok := response["top_k"].([]interface{}); !ok || len(top) != topK {
+		t.Errorf("Response 'top_k' should hold %d labels, got %v", topK, response["top_k"])
+	}
+	for _, key := range []string{"entropy", "low_confidence"} {
+		if _, ok := response[key]; !ok {
+			t.Errorf("Response missing '%s' field", key)
+		}
+	}
+
 	// Verify 'duration_us' exists and is valid
 	duration, ok := response["duration_us"]
 	if !ok {
@@ -64,3 +93,33 @@ func TestPredictHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestNewPredictResponse(t *testing.T) {
+	confident := []float64{0.01, 0.01, 0.9, 0.02, 0.01, 0.01, 0.01, 0.01, 0.01, 0.01}
+	model := &loadedModel{version: 3, checksum: "abc"}
+	resp := newPredictResponse(confident, model)
+	if resp.ModelVersion != 3 || resp.ModelChecksum != "abc" {
+		t.Errorf("Expected model version 3 (abc), got %d (%s)", resp.ModelVersion, resp.ModelChecksum)
+	}
+	if resp.Prediction != 2 || resp.Confidence != 0.9 {
+		t.Errorf("Expected prediction 2 with confidence 0.9, got %d with %f", resp.Prediction, resp.Confidence)
+	}
+	if resp.LowConfidence {
+		t.Error("A prediction with probability 0.9 should not be flagged as low confidence")
+	}
+	if len(resp.TopK) != topK || resp.TopK[0].Label != 2 || resp.TopK[1].Label != 3 {
+		t.Errorf("Unexpected top-k labels: %+v", resp.TopK)
+	}
+
+	uniform := make([]float64, 10)
+	for i := range uniform {
+		uniform[i] = 0.1
+	}
+	resp = newPredictResponse(uniform, model)
+	if !resp.LowConfidence {
+		t.Error("A uniform distribution should be flagged as low confidence")
+	}
+	if resp.Entropy <= newPredictResponse(confident, model).Entropy {
+		t.Errorf("A uniform distribution should have a higher entropy, got %f", resp.Entropy)
+	}
+}
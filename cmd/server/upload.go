@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Register the JPEG decoder for uploads
+	_ "image/png"  // Register the PNG decoder for uploads
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+var (
+	// invertMode controls whether uploaded images are inverted to white ink on black.
+	invertMode = preprocess.InvertAuto
+	// maxUploadMemory is the part of a multipart upload kept in memory; the rest is buffered on disk.
+	maxUploadMemory int64 = 32 << 20
+	// maxUploadPixels is the largest width*height of an uploaded image. Larger images are rejected
+	// from their header, before the pixels are decoded into memory.
+	maxUploadPixels = 4096 * 4096
+)
+
+// errImageTooLarge is returned for an upload whose dimensions exceed maxUploadPixels.
+var errImageTooLarge = errors.New("image too large")
+
+// isImageUpload reports whether the request carries an image file instead of the JSON pixel format.
+func isImageUpload(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "multipart/form-data" || strings.HasPrefix(mediaType, "image/")
+}
+
+// readUpload decodes a PNG or JPEG image sent either as the raw request body or as the
+// "image" field of a multipart form. It returns the image in grayscale, inverted according to
+// invertMode, and of any size: the preprocessing pipeline of the model turns it into 28x28.
+func readUpload(r *http.Request) (preprocess.Image, error) {
+	var body io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+			return preprocess.Image{}, fmt.Errorf("invalid multipart form: %w", err)
+		}
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			return preprocess.Image{}, fmt.Errorf("missing 'image' file field: %w", err)
+		}
+		defer file.Close()
+		body = file
+	}
+
+	// Check the dimensions first; the header read by DecodeConfig is replayed to Decode
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(body, &header))
+	if err != nil {
+		return preprocess.Image{}, fmt.Errorf("invalid image (expected PNG or JPEG): %w", err)
+	}
+	if config.Width*config.Height > maxUploadPixels {
+		return preprocess.Image{}, fmt.Errorf("%w: %dx%d exceeds %d pixels", errImageTooLarge, config.Width, config.Height, maxUploadPixels)
+	}
+
+	img, format, err := image.Decode(io.MultiReader(&header, body))
+	if err != nil {
+		return preprocess.Image{}, fmt.Errorf("invalid image (expected PNG or JPEG): %w", err)
+	}
+	if format != "png" && format != "jpeg" {
+		return preprocess.Image{}, fmt.Errorf("unsupported image format %q (expected PNG or JPEG)", format)
+	}
+	return preprocess.Invert{Mode: invertMode}.Apply(preprocess.FromImage(img)), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/neural"
+)
+
+// testDigit returns a large black-on-white image of a vertical bar, like a photographed "1".
+func testDigit() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 300))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(90, 40, 120, 260), &image.Uniform{C: color.Black}, image.Point{}, draw.Src)
+	return img
+}
+
+func servePredict(t *testing.T, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequest("POST", "/predict", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(predictHandler).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPredictHandlerImageUpload(t *testing.T) {
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+
+	var pngBody bytes.Buffer
+	if err := png.Encode(&pngBody, testDigit()); err != nil {
+		t.Fatal(err)
+	}
+	var jpegFile bytes.Buffer
+	if err := jpeg.Encode(&jpegFile, testDigit(), nil); err != nil {
+		t.Fatal(err)
+	}
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	part, err := mw.CreateFormFile("image", "digit.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(jpegFile.Bytes())
+	mw.Close()
+
+	for name, rr := range map[string]*httptest.ResponseRecorder{
+		"raw png":        servePredict(t, &pngBody, "image/png"),
+		"multipart jpeg": servePredict(t, &multipartBody, mw.FormDataContentType()),
+	} {
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: got status %v want %v (%s)", name, rr.Code, http.StatusOK, rr.Body.String())
+			continue
+		}
+		var response predictResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Errorf("%s: failed to decode response: %v", name, err)
+		}
+		if len(response.Probabilities) != 10 {
+			t.Errorf("%s: expected 10 probabilities, got %d", name, len(response.Probabilities))
+		}
+	}
+
+	if rr := servePredict(t, bytes.NewBufferString("not an image"), "image/png"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid image: got status %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPredictHandlerImageTooLarge(t *testing.T) {
+	setTestModel(t, neural.NewNetwork(784, 10, 10, 0.1))
+	defer func(limit int) { maxUploadPixels = limit }(maxUploadPixels)
+	maxUploadPixels = 200 * 300
+
+	var fits, tooLarge bytes.Buffer
+	if err := png.Encode(&fits, testDigit()); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&tooLarge, image.NewGray(image.Rect(0, 0, 200, 301))); err != nil {
+		t.Fatal(err)
+	}
+	if rr := servePredict(t, &fits, "image/png"); rr.Code != http.StatusOK {
+		t.Errorf("Image at the limit: got status %v want %v (%s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if rr := servePredict(t, &tooLarge, "image/png"); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Image over the limit: got status %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"path/filepath"
 	"time"
 
+	"github.com/coolspeed/go-mnist-scratch/augment"
+	"github.com/coolspeed/go-mnist-scratch/dataset"
+	"github.com/coolspeed/go-mnist-scratch/logging"
 	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/metrics"
 	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+	"github.com/coolspeed/go-mnist-scratch/train"
 	"github.com/coolspeed/go-mnist-scratch/utils"
 )
 
@@ -22,10 +29,75 @@ const (
 	modelPath   = "mnist_model.gob" // Using .gob for now, CLAUDE.md suggests JSON/Gob
 )
 
+// options holds the command line flags that configure the callbacks, the preprocessing and the augmentation.
+type options struct {
+	pipeline   preprocess.Pipeline // Applied to every image and recorded in the model metadata
+	augment    augment.Config      // Applied to the training images on the fly, after the pipeline
+	seed       int64               // Seeds the shuffling and the augmentation
+	logger     *metrics.Logger
+	logEvery   int
+	checkpoint string
+	patience   int
+	lrDecay    float64
+	lrStep     int
+}
+
 func main() {
+	precision := flag.String("precision", "float64", "Compute precision for training: float64 or float32")
+	metricsPath := flag.String("metrics", "", "Write per-epoch metrics to this file (disabled if empty)")
+	metricsFormat := flag.String("metrics-format", "", "Metrics file format: csv or jsonl (default: inferred from the file extension)")
+	var opts options
+	flag.IntVar(&opts.logEvery, "log-every", 0, "Also write a metrics record every N batches (0 = per epoch only)")
+	flag.StringVar(&opts.checkpoint, "checkpoint", "", "Save the best model by test accuracy to this file during training (disabled if empty)")
+	flag.IntVar(&opts.patience, "patience", 0, "Stop after N epochs without test loss improvement (0 = disabled)")
+	flag.Float64Var(&opts.lrDecay, "lr-decay", 1.0, "Multiply the learning rate by this factor every -lr-step epochs")
+	flag.IntVar(&opts.lrStep, "lr-step", 1, "Number of epochs between learning rate decays")
+	preprocessSpec := flag.String("preprocess", "none", "Preprocessing pipeline applied to every image, saved with the model so validate and server apply the same steps, e.g. \"crop,resize=20,pad=28,com\" (\"none\" trains on the images as published)")
+	deskew := flag.Bool("deskew", false, "Add moment-based deskewing to the -preprocess pipeline")
+	augmentSpec := flag.String("augment", "none", "Random distortions of the training images as transform=probability pairs, e.g. \"affine=0.5,elastic=0.3,noise=0.2,erase=0.2,morph=0.2\" (\"default\" for all, \"none\" to disable)")
+	flag.Int64Var(&opts.seed, "seed", 0, "Seed for shuffling and augmentation (0 = time-based)")
+	var logOpts logging.Options
+	logOpts.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := logOpts.Setup(); err != nil {
+		logging.Fatal("invalid logging flags", "err", err)
+	}
+	pipeline, err := preprocess.Parse(*preprocessSpec)
+	if err != nil {
+		logging.Fatal("invalid preprocessing pipeline", "err", err)
+	}
+	if *deskew {
+		pipeline = pipeline.WithDeskew()
+	}
+	opts.pipeline = pipeline
+	if opts.augment, err = augment.Parse(*augmentSpec); err != nil {
+		logging.Fatal("invalid augmentation", "err", err)
+	}
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+
+	if *metricsPath != "" {
+		format := metrics.FormatFromPath(*metricsPath)
+		if *metricsFormat != "" {
+			f, err := metrics.ParseFormat(*metricsFormat)
+			if err != nil {
+				logging.Fatal("invalid metrics format", "err", err)
+			}
+			format = f
+		}
+		l, err := metrics.Create(*metricsPath, format)
+		if err != nil {
+			logging.Fatal("error opening metrics log", "path", *metricsPath, "err", err)
+		}
+		defer l.Close()
+		opts.logger = l
+	}
+
 	rand.Seed(time.Now().UnixNano())
 
-	fmt.Println("Loading MNIST data...")
+	slog.Info("loading MNIST data")
 	trainImagePath := filepath.Join("data", "train-images-idx3-ubyte.gz")
 	trainLabelPath := filepath.Join("data", "train-labels-idx1-ubyte.gz")
 	testImagePath := filepath.Join("data", "t10k-images-idx3-ubyte.gz")
@@ -33,76 +105,106 @@ func main() {
 
 	trainImagesData, trainLabelsData, err := utils.LoadMNIST(trainImagePath, trainLabelPath)
 	if err != nil {
-		log.Fatalf("Error loading training data: %v", err)
+		logging.Fatal("error loading training data", "err", err)
 	}
 	testImagesData, testLabelsData, err := utils.LoadMNIST(testImagePath, testLabelPath)
 	if err != nil {
-		log.Fatalf("Error loading testing data: %v", err)
+		logging.Fatal("error loading testing data", "err", err)
 	}
 
-	fmt.Printf("Training images loaded: %d\n", trainImagesData.NumImages)
-	fmt.Printf("Training labels loaded: %d\n", trainLabelsData.NumLabels)
-	fmt.Printf("Test images loaded: %d\n", testImagesData.NumImages)
-	fmt.Printf("Test labels loaded: %d\n", testLabelsData.NumLabels)
-
-	net := neural.NewNetwork(inputSize, hiddenSize, outputSize, learningRate)
+	slog.Info("MNIST data loaded",
+		"train_images", trainImagesData.NumImages, "train_labels", trainLabelsData.NumLabels,
+		"test_images", testImagesData.NumImages, "test_labels", testLabelsData.NumLabels)
 
-	fmt.Println("Starting training...")
-	for e := 0; e < epochs; e++ {
-		fmt.Printf("Epoch %d/%d\n", e+1, epochs)
-
-		// Shuffle training data
-		perm := rand.Perm(int(trainImagesData.NumImages))
-
-		for i := 0; i < int(trainImagesData.NumImages); i += batchSize {
-			end := i + batchSize
-			if end > int(trainImagesData.NumImages) {
-				end = int(trainImagesData.NumImages)
-			}
+	if len(pipeline) > 0 {
+		slog.Info("preprocessing images", "pipeline", pipeline.String())
+		if trainImagesData, err = trainImagesData.Preprocess(pipeline); err != nil {
+			logging.Fatal("error preprocessing training data", "err", err)
+		}
+		if testImagesData, err = testImagesData.Preprocess(pipeline); err != nil {
+			logging.Fatal("error preprocessing testing data", "err", err)
+		}
+	}
 
-			// For simplicity, current Train method handles single sample.
-			// Batching logic would involve averaging gradients.
-			// For now, process each sample in the batch individually.
-			for j := i; j < end; j++ {
-				idx := perm[j]
-				inputMatrix := matrix.NewMatrix(1, inputSize)
-				inputMatrix[0] = trainImagesData.Images[idx]
-
-				targetMatrix := matrix.NewMatrix(1, outputSize)
-				targetMatrix[0] = utils.OneHotEncode(trainLabelsData.Labels[idx], outputSize)
-
-				err := net.Train(inputMatrix, targetMatrix)
-				if err != nil {
-					log.Printf("Error training on sample %d: %v", idx, err)
-				}
-			}
+	switch *precision {
+	case "float64":
+		run(neural.NewNetwork(inputSize, hiddenSize, outputSize, learningRate), trainImagesData, trainLabelsData, testImagesData, testLabelsData, opts)
+	case "float32":
+		run(neural.NewNetwork32(inputSize, hiddenSize, outputSize, learningRate), trainImagesData, trainLabelsData, testImagesData, testLabelsData, opts)
+	default:
+		logging.Fatal("unknown precision (expected float64 or float32)", "precision", *precision)
+	}
+}
+
+// run trains net in precision T with the callbacks selected by opts and saves the resulting model.
+func run[T matrix.Float](net *neural.Model[T], trainImagesData *utils.ImageData, trainLabelsData *utils.LabelData, testImagesData *utils.ImageData, testLabelsData *utils.LabelData, opts options) {
+	net.Meta = neural.Metadata{
+		Precision:    fmt.Sprintf("%T", T(0)),
+		BatchSize:    batchSize,
+		LearningRate: net.LearningRate,
+		TrainSamples: len(trainImagesData.Images),
+		Preprocess:   opts.pipeline.String(),
+	}
+	if opts.augment.Enabled() {
+		net.Meta.Augment = opts.augment.String()
+	}
+	// Keep the metadata current after every epoch, so checkpoints saved mid-training carry it too
+	recordMetadata := train.Funcs[T]{EpochEnd: func(s *train.State[T]) error {
+		net.Meta.TrainedAt = time.Now()
+		net.Meta.Duration = time.Since(s.StartTime)
+		net.Meta.Epochs = s.Epoch
+		if s.HasValidation {
+			net.Meta.TestAccuracy, net.Meta.TestLoss = s.ValAccuracy, s.ValLoss
 		}
+		return nil
+	}}
 
-		// Evaluate accuracy on test set after each epoch (optional, but good for monitoring)
-		correct := 0
-		for i := 0; i < int(testImagesData.NumImages); i++ {
-			inputMatrix := matrix.NewMatrix(1, inputSize)
-			inputMatrix[0] = testImagesData.Images[i]
+	callbacks := []train.Callback[T]{&train.LRScheduler[T]{Schedule: train.StepDecay(opts.lrStep, opts.lrDecay)}}
+	callbacks = append(callbacks, train.Progress[T]{}, recordMetadata)
+	if opts.logger != nil {
+		callbacks = append(callbacks, &train.MetricsLogger[T]{Logger: opts.logger, Every: opts.logEvery})
+	}
+	if opts.checkpoint != "" {
+		callbacks = append(callbacks, &train.Checkpoint[T]{Path: opts.checkpoint, BestOnly: true})
+	}
+	if opts.patience > 0 {
+		callbacks = append(callbacks, &train.EarlyStopping[T]{Patience: opts.patience})
+	}
 
-			predicted, err := net.Predict(inputMatrix)
-			if err != nil {
-				log.Printf("Error predicting for test sample %d: %v", i, err)
-				continue
-			}
+	trainData, err := dataset.FromMNIST(trainImagesData, trainLabelsData)
+	if err != nil {
+		logging.Fatal("invalid training data", "err", err)
+	}
+	testData, err := dataset.FromMNIST(testImagesData, testLabelsData)
+	if err != nil {
+		logging.Fatal("invalid testing data", "err", err)
+	}
+	if opts.augment.Enabled() {
+		// The augmenter gets its own source so the shuffling order does not depend on the augmentation
+		augmenter := augment.New(opts.augment, int(trainImagesData.NumRows), int(trainImagesData.NumCols), opts.seed+1)
+		trainData = dataset.Transform(trainData, augmenter.Apply)
+	}
 
-			actual := int(testLabelsData.Labels[i])
-			if predicted == actual {
-				correct++
-			}
-		}
-		accuracy := float64(correct) / float64(testImagesData.NumImages) * 100
-		fmt.Printf("Epoch %d: Test Accuracy: %.2f%%\n", e+1, accuracy)
+	trainer := &train.Trainer[T]{
+		Net:        net,
+		TrainData:  trainData,
+		ValData:    testData,
+		NumClasses: outputSize,
+		Epochs:     epochs,
+		BatchSize:  batchSize,
+		Callbacks:  callbacks,
+		Rand:       rand.New(rand.NewSource(opts.seed)),
 	}
 
-	fmt.Println("Training complete. Saving model...")
-	err = net.SaveModel(modelPath)
-	if err != nil {
-		log.Fatalf("Error saving model: %v", err)
+	slog.Info("starting training", "precision", fmt.Sprintf("%T", T(0)), "epochs", epochs, "batch_size", batchSize,
+		"augment", opts.augment.String(), "seed", opts.seed)
+	if err := trainer.Run(); err != nil {
+		logging.Fatal("error training", "err", err)
+	}
+
+	slog.Info("training complete, saving model")
+	if err := net.SaveModel(modelPath); err != nil {
+		logging.Fatal("error saving model", "path", modelPath, "err", err)
 	}
-	fmt.Printf("Model saved to %s\n", modelPath)
-}
\ No newline at end of file
+	slog.Info("model saved", "path", modelPath)
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"image"
+	"log/slog"
+	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
+	"github.com/coolspeed/go-mnist-scratch/dataset"
+	"github.com/coolspeed/go-mnist-scratch/eval"
+	"github.com/coolspeed/go-mnist-scratch/logging"
 	"github.com/coolspeed/go-mnist-scratch/matrix"
 	"github.com/coolspeed/go-mnist-scratch/neural"
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
 	"github.com/coolspeed/go-mnist-scratch/utils"
 )
 
@@ -15,54 +25,319 @@ const (
 	hiddenSize  = 200
 	outputSize  = 10 // 0-9 digits
 	modelPath   = "mnist_model.gob"
+
+	evalBatchSize = 256 // Test samples read from the dataset at once
 )
 
+// options holds the command line flags that configure the outputs of a validation run.
+type options struct {
+	reportPath       string
+	misclassifiedDir string
+	contactSheet     int
+	preprocess       string // Overrides the pipeline recorded in the model if set
+	deskew           bool   // Adds deskewing to the pipeline
+	compareModel     string // Model evaluated with its own pipeline for comparison (disabled if empty)
+}
+
 func main() {
+	precision := flag.String("precision", "float64", "Compute precision for inference: float64 or float32")
+	var opts options
+	flag.StringVar(&opts.reportPath, "report-json", "", "Write the evaluation report as JSON to this file (disabled if empty)")
+	flag.StringVar(&opts.misclassifiedDir, "misclassified-dir", "", "Export every misclassified test image as PNG into this directory (disabled if empty)")
+	flag.IntVar(&opts.contactSheet, "contact-sheet", 100, "Number of most confident mistakes tiled into contact_sheet.png in -misclassified-dir")
+	flag.StringVar(&opts.preprocess, "preprocess", "", "Preprocessing pipeline applied to the test images (default: the pipeline recorded in the model)")
+	flag.BoolVar(&opts.deskew, "deskew", false, "Add moment-based deskewing to the preprocessing pipeline")
+	flag.StringVar(&opts.compareModel, "compare-model", "", "Also evaluate this model, with the pipeline recorded in it, and compare the accuracies, e.g. of models trained with and without -deskew (disabled if empty)")
+	var logOpts logging.Options
+	logOpts.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := logOpts.Setup(); err != nil {
+		logging.Fatal("invalid logging flags", "err", err)
+	}
+
+	switch *precision {
+	case "float64":
+		validate(neural.NewNetwork(inputSize, hiddenSize, outputSize, 0.0), opts) // Learning rate doesn't matter for inference
+	case "float32":
+		validate(neural.NewNetwork32(inputSize, hiddenSize, outputSize, 0.0), opts)
+	default:
+		logging.Fatal("unknown precision (expected float64 or float32)", "precision", *precision)
+	}
+}
+
+// validate loads the model into net, evaluates it in precision T and compares it with its int8 quantization.
+// If configured in opts, the per-class evaluation report is also written as JSON, the misclassified samples are exported as PNGs
+// and another model is evaluated for comparison.
+func validate[T matrix.Float](net *neural.Model[T], opts options) {
 	// 1. Load Model
-	fmt.Printf("Loading model from %s...\n", modelPath)
-	net := neural.NewNetwork(inputSize, hiddenSize, outputSize, 0.0) // Learning rate doesn't matter for inference
+	slog.Info("loading model", "path", modelPath)
 	err := net.LoadModel(modelPath)
 	if err != nil {
-		log.Fatalf("Error loading model: %v", err)
+		logging.Fatal("error loading model", "path", modelPath, "err", err)
 	}
-	fmt.Println("Model loaded successfully.")
+	slog.Info("model loaded", "path", modelPath)
 
 	// 2. Load Test Data
-	fmt.Println("Loading MNIST test data...")
+	slog.Info("loading MNIST test data")
 	testImagePath := filepath.Join("data", "t10k-images-idx3-ubyte.gz")
 	testLabelPath := filepath.Join("data", "t10k-labels-idx1-ubyte.gz")
 
 	testImagesData, testLabelsData, err := utils.LoadMNIST(testImagePath, testLabelPath)
 	if err != nil {
-		log.Fatalf("Error loading testing data: %v", err)
+		logging.Fatal("error loading testing data", "err", err)
+	}
+	slog.Info("MNIST test data loaded", "test_images", testImagesData.NumImages)
+
+	// Prepare the test images like the training images, as the server prepares its inputs
+	pipeline, err := modelPipeline(net.Meta.Preprocess, opts.preprocess)
+	if err != nil {
+		logging.Fatal("invalid preprocessing pipeline", "err", err)
+	}
+	if opts.deskew {
+		pipeline = pipeline.WithDeskew()
+	}
+	rawImagesData := testImagesData
+	if len(pipeline) > 0 {
+		slog.Info("preprocessing test images", "pipeline", pipeline.String())
+		if testImagesData, err = testImagesData.Preprocess(pipeline); err != nil {
+			logging.Fatal("error preprocessing testing data", "err", err)
+		}
+	}
+
+	testData, err := dataset.FromMNIST(testImagesData, testLabelsData)
+	if err != nil {
+		logging.Fatal("invalid testing data", "err", err)
 	}
-	fmt.Printf("Test images loaded: %d\n", testImagesData.NumImages)
 
 	// 3. Evaluate Accuracy
-	fmt.Println("Starting evaluation...")
-	correct := 0
-	total := int(testImagesData.NumImages)
+	slog.Info("starting evaluation")
+	result := evaluate(net.PredictProba, testData, true)
+	slog.Info("evaluation finished", "accuracy", result.accuracy(), "duration", result.duration)
+	fmt.Printf("Final Accuracy: %.2f%%\n\n", result.accuracy())
 
-	for i := 0; i < total; i++ {
-		inputMatrix := matrix.NewMatrix(1, inputSize)
-		inputMatrix[0] = testImagesData.Images[i]
+	confusion := eval.NewConfusionMatrix(outputSize)
+	for i, predicted := range result.predictions {
+		if predicted >= 0 {
+			confusion.Add(int(testLabelsData.Labels[i]), predicted)
+		}
+	}
+	report := confusion.Report()
+	report.WriteText(os.Stdout)
+	if opts.reportPath != "" {
+		if err := writeJSON(opts.reportPath, report); err != nil {
+			logging.Fatal("error writing report", "path", opts.reportPath, "err", err)
+		}
+		slog.Info("report written", "path", opts.reportPath)
+	}
 
-		predicted, err := net.Predict(inputMatrix)
+	if opts.misclassifiedDir != "" {
+		n, err := exportMistakes(opts.misclassifiedDir, opts.contactSheet, result, testImagesData, testLabelsData)
 		if err != nil {
-			log.Printf("Error predicting for test sample %d: %v", i, err)
-			continue
+			logging.Fatal("error exporting misclassified samples", "dir", opts.misclassifiedDir, "err", err)
 		}
+		slog.Info("exported misclassified samples", "count", n, "dir", opts.misclassifiedDir)
+	}
+
+	// 4. Compare with the int8 quantized model
+	slog.Info("evaluating int8 quantized model")
+	qnet := net.Quantize()
+	qResult := evaluate(quantizedProbabilities[T](qnet), testData, false)
+	accuracy, duration := result.accuracy(), result.duration
+	qAccuracy, qDuration := qResult.accuracy(), qResult.duration
+
+	total := time.Duration(testData.Len())
+	fmt.Println("------------------------------------------------")
+	fmt.Printf("%-10s %10s %14s %12s\n", "Precision", "Accuracy", "Avg Inference", "Size")
+	fmt.Printf("%-10T %9.2f%% %14v %9.1f KB\n", T(0), accuracy, duration/total, float64(net.SizeBytes())/1024)
+	fmt.Printf("%-10s %9.2f%% %14v %9.1f KB\n", "int8", qAccuracy, qDuration/total, float64(qnet.SizeBytes())/1024)
+	fmt.Println("------------------------------------------------")
+	fmt.Printf("Accuracy Drop: %.2f%%p\n", accuracy-qAccuracy)
+	fmt.Printf("Speedup: %.2fx\n", float64(duration)/float64(qDuration))
+	fmt.Printf("Size Reduction: %.2fx\n", float64(net.SizeBytes())/float64(qnet.SizeBytes()))
+
+	// 5. Compare with another model, e.g. trained with the other deskewing setting
+	if opts.compareModel != "" {
+		compareModels[T](pipeline, accuracy, opts.compareModel, rawImagesData, testLabelsData)
+	}
+}
 
-		actual := int(testLabelsData.Labels[i])
-		if predicted == actual {
-			correct++
+// compareModels evaluates the model at path on the raw test images, prepared with the pipeline recorded in
+// that model, and prints its accuracy next to the accuracy of the validated model, measured with pipeline.
+// If exactly one of the two pipelines deskews, as for models trained with and without -deskew, the difference
+// is reported as the gain of deskewing.
+func compareModels[T matrix.Float](pipeline preprocess.Pipeline, accuracy float64, path string, raw *utils.ImageData, labels *utils.LabelData) {
+	slog.Info("loading comparison model", "path", path)
+	other := neural.NewModel[T](inputSize, hiddenSize, outputSize, 0.0)
+	if err := other.LoadModel(path); err != nil {
+		logging.Fatal("error loading comparison model", "path", path, "err", err)
+	}
+	otherPipeline, err := modelPipeline(other.Meta.Preprocess, "")
+	if err != nil {
+		logging.Fatal("invalid preprocessing pipeline in the comparison model", "path", path, "err", err)
+	}
+	images := raw
+	if len(otherPipeline) > 0 {
+		slog.Info("preprocessing test images for the comparison model", "pipeline", otherPipeline.String())
+		if images, err = raw.Preprocess(otherPipeline); err != nil {
+			logging.Fatal("error preprocessing testing data", "err", err)
 		}
-		
-		if (i+1)%1000 == 0 {
-			fmt.Printf("Processed %d/%d samples...\n", i+1, total)
+	}
+	otherData, err := dataset.FromMNIST(images, labels)
+	if err != nil {
+		logging.Fatal("invalid testing data", "err", err)
+	}
+	otherAccuracy := evaluate(other.PredictProba, otherData, false).accuracy()
+
+	fmt.Println("------------------------------------------------")
+	fmt.Printf("%-20s %-36s %10s\n", "Model", "Preprocessing", "Accuracy")
+	fmt.Printf("%-20s %-36s %9.2f%%\n", modelPath, pipeline, accuracy)
+	fmt.Printf("%-20s %-36s %9.2f%%\n", filepath.Base(path), otherPipeline, otherAccuracy)
+	fmt.Println("------------------------------------------------")
+	switch {
+	case otherPipeline.HasDeskew() && !pipeline.HasDeskew():
+		fmt.Printf("Deskew Gain: %+.2f%%p\n", otherAccuracy-accuracy)
+	case pipeline.HasDeskew() && !otherPipeline.HasDeskew():
+		fmt.Printf("Deskew Gain: %+.2f%%p\n", accuracy-otherAccuracy)
+	default:
+		fmt.Printf("Accuracy Difference: %+.2f%%p\n", otherAccuracy-accuracy)
+	}
+}
+
+// modelPipeline returns the preprocessing pipeline given by override, else the one recorded in the model.
+// Models saved without a pipeline were trained on the raw digits and get none, with a warning.
+func modelPipeline(recorded, override string) (preprocess.Pipeline, error) {
+	switch {
+	case override != "":
+		return preprocess.Parse(override)
+	case recorded != "":
+		return preprocess.Parse(recorded)
+	}
+	slog.Warn("model has no recorded preprocessing pipeline, evaluating the raw test images")
+	return nil, nil
+}
+
+// evaluation holds the outcome of running a model over the test set.
+type evaluation struct {
+	predictions []int     // Predicted class per sample, -1 if prediction failed
+	confidences []float64 // Probability of the predicted class per sample
+	correct     int
+	duration    time.Duration // Total time spent in the model
+}
+
+// accuracy returns the accuracy in percent.
+func (e *evaluation) accuracy() float64 {
+	return float64(e.correct) / float64(len(e.predictions)) * 100
+}
+
+// quantizedProbabilities adapts an int8 quantized network to the PredictProba signature of a network in precision T.
+func quantizedProbabilities[T matrix.Float](q *neural.QuantizedNetwork) func(matrix.Dense[T]) ([]float64, error) {
+	return func(input matrix.Dense[T]) ([]float64, error) {
+		out, err := q.Forward(matrix.Convert[float64](input))
+		if err != nil {
+			return nil, err
 		}
+		return out[0], nil
 	}
+}
+
+// evaluate runs predict over the whole test set and records the predicted class and its confidence per sample.
+// The samples are read in batches, but predicted one at a time to measure the latency of a single inference.
+func evaluate[T matrix.Float](predict func(matrix.Dense[T]) ([]float64, error), data dataset.Dataset, showProgress bool) *evaluation {
+	total := data.Len()
+	result := &evaluation{
+		predictions: make([]int, total),
+		confidences: make([]float64, total),
+	}
+
+	loader := &dataset.DataLoader{Dataset: data, BatchSize: evalBatchSize, NumClasses: outputSize, Prefetch: 1}
+	for batch := range loader.Batches() {
+		inputs := matrix.Convert[T](batch.Inputs)
+		for j, i := range batch.Indices {
+			start := time.Now()
+			probs, err := predict(inputs[j : j+1])
+			result.duration += time.Since(start)
+			if err != nil {
+				slog.Warn("prediction failed", "sample", i, "err", err)
+				result.predictions[i] = -1
+				continue
+			}
+
+			predicted := 0
+			for k, p := range probs {
+				if p > probs[predicted] {
+					predicted = k
+				}
+			}
+			result.predictions[i] = predicted
+			result.confidences[i] = probs[predicted]
+			if predicted == int(batch.Labels[j]) {
+				result.correct++
+			}
+
+			if showProgress && (i+1)%1000 == 0 {
+				slog.Info("evaluation progress", "processed", i+1, "total", total)
+			}
+		}
+	}
+
+	return result
+}
 
-	accuracy := float64(correct) / float64(total) * 100
-	fmt.Printf("\nFinal Accuracy: %.2f%%\n", accuracy)
+// exportMistakes writes every misclassified sample to dir as a PNG named after its index, true label,
+// predicted label and confidence. The sheetSize most confident mistakes are also tiled into contact_sheet.png,
+// with contact_sheet.csv listing the sample shown in each tile. It returns the number of exported samples.
+func exportMistakes(dir string, sheetSize int, result *evaluation, images *utils.ImageData, labels *utils.LabelData) (int, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	var mistakes []int // Indices of the exported samples
+	for i, predicted := range result.predictions {
+		if predicted < 0 || predicted == int(labels.Labels[i]) {
+			continue
+		}
+		mistakes = append(mistakes, i)
+		name := fmt.Sprintf("%05d_true%d_pred%d_conf%.3f.png", i, labels.Labels[i], predicted, result.confidences[i])
+		if err := utils.SavePNG(filepath.Join(dir, name), images.Image(i)); err != nil {
+			return 0, err
+		}
+	}
+
+	exported := len(mistakes)
+	sort.SliceStable(mistakes, func(a, b int) bool {
+		return result.confidences[mistakes[a]] > result.confidences[mistakes[b]]
+	})
+	if sheetSize < 0 {
+		sheetSize = 0
+	}
+	if len(mistakes) > sheetSize {
+		mistakes = mistakes[:sheetSize]
+	}
+	if len(mistakes) == 0 {
+		return exported, nil
+	}
+
+	tiles := make([]*image.Gray, len(mistakes))
+	index := "tile,index,true,predicted,confidence\n"
+	for t, i := range mistakes {
+		tiles[t] = images.Image(i)
+		index += fmt.Sprintf("%d,%d,%d,%d,%.4f\n", t, i, labels.Labels[i], result.predictions[i], result.confidences[i])
+	}
+	if err := utils.SavePNG(filepath.Join(dir, "contact_sheet.png"), utils.ContactSheet(tiles, 10, 2)); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "contact_sheet.csv"), []byte(index), 0o644); err != nil {
+		return 0, fmt.Errorf("failed to write contact sheet index: %w", err)
+	}
+	return exported, nil
+}
+
+// writeJSON writes v to path as indented JSON.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
 }
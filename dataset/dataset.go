@@ -0,0 +1,131 @@
+// Package dataset provides indexable collections of labeled images, wrappers that reorder,
+// select, transform and join them without copying the data, and a DataLoader that groups
+// them into batches for training and evaluation.
+package dataset
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/coolspeed/go-mnist-scratch/utils"
+)
+
+// Sample is a single labeled image.
+type Sample struct {
+	Pixels []float64 // Normalized pixels stored row by row
+	Label  uint8
+}
+
+// Dataset is a fixed-size collection of samples. Get must return the same sample for the same index,
+// except for datasets that deliberately randomize it such as Transform with an augmenter.
+// Callers must not modify the returned pixels.
+type Dataset interface {
+	Len() int
+	Get(i int) Sample
+}
+
+// inMemory serves samples from parallel slices of images and labels.
+type inMemory struct {
+	images [][]float64
+	labels []uint8
+}
+
+func (d *inMemory) Len() int { return len(d.images) }
+
+func (d *inMemory) Get(i int) Sample { return Sample{Pixels: d.images[i], Label: d.labels[i]} }
+
+// FromSlices returns a dataset of images with their labels. The slices are used without copying.
+func FromSlices(images [][]float64, labels []uint8) (Dataset, error) {
+	if len(images) != len(labels) {
+		return nil, fmt.Errorf("dataset mismatch: %d images and %d labels", len(images), len(labels))
+	}
+	return &inMemory{images: images, labels: labels}, nil
+}
+
+// FromMNIST returns a dataset of loaded MNIST images and labels.
+func FromMNIST(images *utils.ImageData, labels *utils.LabelData) (Dataset, error) {
+	return FromSlices(images.Images, labels.Labels)
+}
+
+// subset is a view of selected samples of another dataset.
+type subset struct {
+	Dataset
+	indices []int
+}
+
+func (d *subset) Len() int { return len(d.indices) }
+
+func (d *subset) Get(i int) Sample { return d.Dataset.Get(d.indices[i]) }
+
+// Subset returns the samples of d at indices, in that order. Indices may repeat.
+// It fails if an index is out of range.
+func Subset(d Dataset, indices []int) (Dataset, error) {
+	for _, i := range indices {
+		if i < 0 || i >= d.Len() {
+			return nil, fmt.Errorf("subset index %d out of range for %d samples", i, d.Len())
+		}
+	}
+	return &subset{Dataset: d, indices: indices}, nil
+}
+
+// Shuffle returns the samples of d in a random order drawn once from r.
+// A DataLoader with Shuffle set draws a new order for every pass instead.
+func Shuffle(d Dataset, r *rand.Rand) Dataset {
+	return &subset{Dataset: d, indices: r.Perm(d.Len())}
+}
+
+// mapped applies a function to every sample of another dataset when it is read.
+type mapped struct {
+	Dataset
+	fn func(Sample) Sample
+}
+
+func (d *mapped) Get(i int) Sample { return d.fn(d.Dataset.Get(i)) }
+
+// Map returns d with fn applied to every sample each time it is read. fn must not modify its input.
+// When the dataset is read by a DataLoader with prefetching, fn runs on the prefetch goroutine.
+func Map(d Dataset, fn func(Sample) Sample) Dataset {
+	return &mapped{Dataset: d, fn: fn}
+}
+
+// Transform returns d with fn applied to the pixels of every sample each time it is read,
+// such as a preprocessing step or a random augmentation. The labels are unchanged.
+func Transform(d Dataset, fn func(pixels []float64) []float64) Dataset {
+	return Map(d, func(s Sample) Sample {
+		s.Pixels = fn(s.Pixels)
+		return s
+	})
+}
+
+// concat joins several datasets end to end.
+type concat struct {
+	parts []Dataset
+	ends  []int // Cumulative length up to and including each part
+}
+
+func (d *concat) Len() int {
+	if len(d.ends) == 0 {
+		return 0
+	}
+	return d.ends[len(d.ends)-1]
+}
+
+func (d *concat) Get(i int) Sample {
+	part := sort.SearchInts(d.ends, i+1)
+	if part > 0 {
+		i -= d.ends[part-1]
+	}
+	return d.parts[part].Get(i)
+}
+
+// Concat returns the samples of every dataset in ds, one after the other.
+func Concat(ds ...Dataset) Dataset {
+	c := &concat{parts: ds, ends: make([]int, len(ds))}
+	total := 0
+	for i, d := range ds {
+		total += d.Len()
+		c.ends[i] = total
+	}
+	return c
+}
@@ -0,0 +1,116 @@
+package dataset
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// numbered returns a dataset of n samples whose single pixel and label are the sample index.
+func numbered(t *testing.T, n int) Dataset {
+	t.Helper()
+	images := make([][]float64, n)
+	labels := make([]uint8, n)
+	for i := range images {
+		images[i] = []float64{float64(i)}
+		labels[i] = uint8(i)
+	}
+	d, err := FromSlices(images, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// labels returns the labels of every sample of d in order.
+func labels(d Dataset) []int {
+	out := make([]int, d.Len())
+	for i := range out {
+		out[i] = int(d.Get(i).Label)
+	}
+	return out
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFromSlices(t *testing.T) {
+	d := numbered(t, 3)
+	if d.Len() != 3 {
+		t.Fatalf("Expected 3 samples, Got %d", d.Len())
+	}
+	if s := d.Get(2); s.Label != 2 || s.Pixels[0] != 2 {
+		t.Errorf("Expected sample 2, Got %+v", s)
+	}
+	if _, err := FromSlices(make([][]float64, 2), make([]uint8, 3)); err == nil {
+		t.Error("Expected an error for mismatched images and labels")
+	}
+}
+
+func TestSubsetAndShuffle(t *testing.T) {
+	d := numbered(t, 5)
+	sub, err := Subset(d, []int{4, 0, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := labels(sub); !equalInts(got, []int{4, 0, 4}) {
+		t.Errorf("Expected [4 0 4], Got %v", got)
+	}
+	if _, err := Subset(d, []int{5}); err == nil {
+		t.Error("Expected an error for an index out of range")
+	}
+
+	shuffled := Shuffle(d, rand.New(rand.NewSource(1)))
+	got := labels(shuffled)
+	seen := make(map[int]bool)
+	for _, l := range got {
+		seen[l] = true
+	}
+	if len(got) != 5 || len(seen) != 5 {
+		t.Errorf("Expected a permutation of the 5 samples, Got %v", got)
+	}
+	if !equalInts(got, labels(shuffled)) {
+		t.Error("Expected the shuffled order to stay fixed")
+	}
+	if !equalInts(got, labels(Shuffle(d, rand.New(rand.NewSource(1))))) {
+		t.Error("Expected the same seed to give the same order")
+	}
+}
+
+func TestMapAndTransform(t *testing.T) {
+	d := numbered(t, 3)
+	doubled := Transform(d, func(pixels []float64) []float64 { return []float64{pixels[0] * 2} })
+	if doubled.Len() != 3 {
+		t.Fatalf("Expected 3 samples, Got %d", doubled.Len())
+	}
+	if s := doubled.Get(2); s.Pixels[0] != 4 || s.Label != 2 {
+		t.Errorf("Expected pixel 4 with label 2, Got %+v", s)
+	}
+	if d.Get(2).Pixels[0] != 2 {
+		t.Error("Expected the underlying dataset to be unchanged")
+	}
+
+	relabeled := Map(d, func(s Sample) Sample { s.Label = 9 - s.Label; return s })
+	if got := labels(relabeled); !equalInts(got, []int{9, 8, 7}) {
+		t.Errorf("Expected [9 8 7], Got %v", got)
+	}
+}
+
+func TestConcat(t *testing.T) {
+	a, b := numbered(t, 2), numbered(t, 3)
+	c := Concat(a, Concat(), b)
+	if got := labels(c); !equalInts(got, []int{0, 1, 0, 1, 2}) {
+		t.Errorf("Expected [0 1 0 1 2], Got %v", got)
+	}
+	if Concat().Len() != 0 {
+		t.Error("Expected an empty concatenation")
+	}
+}
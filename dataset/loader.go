@@ -0,0 +1,139 @@
+package dataset
+
+import (
+	"iter"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/utils"
+)
+
+// Batch is a group of samples ready to be fed to a network.
+type Batch struct {
+	Inputs  matrix.Matrix // One row of pixels per sample; rows share memory with the dataset and must not be modified
+	Targets matrix.Matrix // One-hot encoded labels, one row per sample
+	Labels  []uint8
+	Indices []int // Index of every sample in the dataset
+}
+
+// Len returns the number of samples in the batch.
+func (b Batch) Len() int { return len(b.Labels) }
+
+// DataLoader iterates over a dataset in batches.
+type DataLoader struct {
+	Dataset    Dataset
+	BatchSize  int // Samples per batch (1 if not positive)
+	NumClasses int // Length of the one-hot targets
+
+	// Shuffle draws a new random order from Rand for every pass. A time-seeded source is used if Rand is nil.
+	Shuffle bool
+	Rand    *rand.Rand
+
+	// DropLast skips the final batch of a pass if it has fewer than BatchSize samples
+	DropLast bool
+
+	// Prefetch is the number of batches a background goroutine prepares ahead of the consumer,
+	// so reading and transforming samples overlaps with training. 0 reads every batch on demand.
+	Prefetch int
+}
+
+// batchSize returns the effective batch size.
+func (l *DataLoader) batchSize() int {
+	return max(1, l.BatchSize)
+}
+
+// NumBatches returns the number of batches in one pass.
+func (l *DataLoader) NumBatches() int {
+	n, size := l.Dataset.Len(), l.batchSize()
+	if l.DropLast {
+		return n / size
+	}
+	return (n + size - 1) / size
+}
+
+// Batches returns an iterator over one pass of the dataset:
+//
+//	for batch := range loader.Batches() { ... }
+//
+// The order is drawn when the iteration starts. Breaking out of the loop stops the prefetch goroutine.
+// Samples are read by a single goroutine, in order, so a randomized dataset gives reproducible batches
+// for a seeded source. A loader must not be iterated by several loops at the same time.
+func (l *DataLoader) Batches() iter.Seq[Batch] {
+	return func(yield func(Batch) bool) {
+		order := l.order()
+		size, n := l.batchSize(), l.NumBatches()
+		batch := func(b int) Batch {
+			return l.batch(order[b*size : min((b+1)*size, len(order))])
+		}
+
+		if l.Prefetch <= 0 {
+			for b := 0; b < n; b++ {
+				if !yield(batch(b)) {
+					return
+				}
+			}
+			return
+		}
+
+		batches := make(chan Batch, l.Prefetch)
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(batches)
+			for b := 0; b < n; b++ {
+				select {
+				case batches <- batch(b):
+				case <-done:
+					return
+				}
+			}
+		}()
+		// Wait for the producer, so a following pass never reads the dataset concurrently with it
+		defer wg.Wait()
+		defer close(done)
+
+		for b := range batches {
+			if !yield(b) {
+				return
+			}
+		}
+	}
+}
+
+// order returns the dataset indices in the order of the next pass.
+func (l *DataLoader) order() []int {
+	n := l.Dataset.Len()
+	if l.Shuffle {
+		r := l.Rand
+		if r == nil {
+			r = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		return r.Perm(n)
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// batch reads the samples at indices into a Batch.
+func (l *DataLoader) batch(indices []int) Batch {
+	b := Batch{
+		Inputs:  make(matrix.Matrix, len(indices)),
+		Targets: make(matrix.Matrix, len(indices)),
+		Labels:  make([]uint8, len(indices)),
+		Indices: indices,
+	}
+	for j, idx := range indices {
+		s := l.Dataset.Get(idx)
+		b.Inputs[j] = s.Pixels
+		b.Targets[j] = utils.OneHotEncode(s.Label, l.NumClasses)
+		b.Labels[j] = s.Label
+	}
+	return b
+}
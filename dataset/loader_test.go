@@ -0,0 +1,115 @@
+package dataset
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+// collect returns the labels of every batch of one pass of l.
+func collect(l *DataLoader) [][]int {
+	var batches [][]int
+	for b := range l.Batches() {
+		ls := make([]int, b.Len())
+		for j, label := range b.Labels {
+			ls[j] = int(label)
+		}
+		batches = append(batches, ls)
+	}
+	return batches
+}
+
+func TestDataLoaderBatches(t *testing.T) {
+	for _, prefetch := range []int{0, 2} {
+		l := &DataLoader{Dataset: numbered(t, 10), BatchSize: 4, NumClasses: 10, Prefetch: prefetch}
+		got := collect(l)
+		if len(got) != 3 || l.NumBatches() != 3 {
+			t.Fatalf("prefetch %d: Expected 3 batches, Got %d (NumBatches %d)", prefetch, len(got), l.NumBatches())
+		}
+		if !equalInts(got[0], []int{0, 1, 2, 3}) || !equalInts(got[2], []int{8, 9}) {
+			t.Errorf("prefetch %d: Expected the samples in order with a short last batch, Got %v", prefetch, got)
+		}
+
+		l.DropLast = true
+		if got := collect(l); len(got) != 2 || l.NumBatches() != 2 {
+			t.Errorf("prefetch %d: Expected 2 full batches with DropLast, Got %v", prefetch, got)
+		}
+	}
+}
+
+func TestDataLoaderTargets(t *testing.T) {
+	l := &DataLoader{Dataset: numbered(t, 3), BatchSize: 3, NumClasses: 4}
+	for b := range l.Batches() {
+		if len(b.Inputs) != 3 || len(b.Targets) != 3 || !equalInts(b.Indices, []int{0, 1, 2}) {
+			t.Fatalf("Expected 3 rows, Got inputs %v, targets %v, indices %v", b.Inputs, b.Targets, b.Indices)
+		}
+		for j, row := range b.Targets {
+			for k, v := range row {
+				want := 0.0
+				if k == j {
+					want = 1
+				}
+				if v != want {
+					t.Errorf("Sample %d: Expected one-hot target %d, Got %v", j, j, row)
+					break
+				}
+			}
+			if b.Inputs[j][0] != float64(j) {
+				t.Errorf("Sample %d: Expected pixel %d, Got %v", j, j, b.Inputs[j])
+			}
+		}
+	}
+}
+
+func TestDataLoaderShuffle(t *testing.T) {
+	newLoader := func(seed int64) *DataLoader {
+		return &DataLoader{Dataset: numbered(t, 20), BatchSize: 6, Shuffle: true, Rand: rand.New(rand.NewSource(seed)), Prefetch: 1}
+	}
+	l := newLoader(3)
+	first, second := collect(l), collect(l)
+
+	seen := make(map[int]int)
+	for _, batch := range first {
+		for _, label := range batch {
+			seen[label]++
+		}
+	}
+	if len(seen) != 20 {
+		t.Errorf("Expected every sample exactly once per pass, Got %v", seen)
+	}
+	same := true
+	for i := range first {
+		same = same && equalInts(first[i], second[i])
+	}
+	if same {
+		t.Error("Expected a new order for every pass")
+	}
+
+	replay := collect(newLoader(3))
+	for i := range first {
+		if !equalInts(first[i], replay[i]) {
+			t.Fatalf("Expected the same seed to give the same batches, Got %v and %v", first, replay)
+		}
+	}
+}
+
+func TestDataLoaderEarlyBreak(t *testing.T) {
+	var reads atomic.Int64
+	counted := Map(numbered(t, 100), func(s Sample) Sample { reads.Add(1); return s })
+	l := &DataLoader{Dataset: counted, BatchSize: 5, Prefetch: 2}
+
+	for range l.Batches() {
+		break
+	}
+	// The consumed batch, the buffered ones and the one being prepared at most
+	if n := reads.Load(); n > 4*5 {
+		t.Errorf("Expected the prefetch goroutine to stop after a break, Got %d samples read", n)
+	}
+	after := reads.Load()
+	if got := collect(l); len(got) != 20 {
+		t.Errorf("Expected a full pass after a break, Got %d batches", len(got))
+	}
+	if n := reads.Load() - after; n != 100 {
+		t.Errorf("Expected 100 samples read in a full pass, Got %d", n)
+	}
+}
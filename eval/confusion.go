@@ -0,0 +1,222 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ConfusionMatrix counts predictions per class: Counts[actual][predicted].
+type ConfusionMatrix struct {
+	Counts [][]int
+}
+
+// NewConfusionMatrix creates an empty confusion matrix for numClasses classes.
+func NewConfusionMatrix(numClasses int) *ConfusionMatrix {
+	counts := make([][]int, numClasses)
+	for i := range counts {
+		counts[i] = make([]int, numClasses)
+	}
+	return &ConfusionMatrix{Counts: counts}
+}
+
+// NumClasses returns the number of classes tracked by the matrix.
+func (c *ConfusionMatrix) NumClasses() int {
+	return len(c.Counts)
+}
+
+// Add records one prediction. Out-of-range labels are ignored.
+func (c *ConfusionMatrix) Add(actual, predicted int) {
+	n := c.NumClasses()
+	if actual < 0 || actual >= n || predicted < 0 || predicted >= n {
+		return
+	}
+	c.Counts[actual][predicted]++
+}
+
+// Total returns the number of recorded predictions.
+func (c *ConfusionMatrix) Total() int {
+	total := 0
+	for _, row := range c.Counts {
+		for _, count := range row {
+			total += count
+		}
+	}
+	return total
+}
+
+// Accuracy returns the fraction of predictions on the diagonal, or 0 if nothing was recorded.
+func (c *ConfusionMatrix) Accuracy() float64 {
+	total := c.Total()
+	if total == 0 {
+		return 0
+	}
+	correct := 0
+	for i := range c.Counts {
+		correct += c.Counts[i][i]
+	}
+	return float64(correct) / float64(total)
+}
+
+// Max returns the largest single cell count, which is useful for scaling visualizations.
+func (c *ConfusionMatrix) Max() int {
+	maxCount := 0
+	for _, row := range c.Counts {
+		for _, count := range row {
+			if count > maxCount {
+				maxCount = count
+			}
+		}
+	}
+	return maxCount
+}
+
+// ClassMetrics holds the precision, recall and F1 score of a single class.
+type ClassMetrics struct {
+	Class     int     `json:"class"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	Support   int     `json:"support"` // Number of samples whose true label is Class
+}
+
+// Average holds precision, recall and F1 averaged over classes.
+type Average struct {
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+}
+
+// Confusion is an off-diagonal cell of the confusion matrix.
+type Confusion struct {
+	Actual    int `json:"actual"`
+	Predicted int `json:"predicted"`
+	Count     int `json:"count"`
+}
+
+// Report is a machine-readable summary of a confusion matrix.
+type Report struct {
+	Accuracy        float64        `json:"accuracy"`
+	Total           int            `json:"total"`
+	Classes         []ClassMetrics `json:"classes"`
+	MacroAverage    Average        `json:"macro_average"`    // Unweighted mean over classes
+	WeightedAverage Average        `json:"weighted_average"` // Mean over classes weighted by support
+	TopConfusions   []Confusion    `json:"top_confusions"`   // Most frequent mistakes first
+	ConfusionMatrix [][]int        `json:"confusion_matrix"` // [actual][predicted]
+}
+
+// ClassMetrics computes precision, recall, F1 and support for every class.
+// A metric whose denominator is zero is reported as 0.
+func (c *ConfusionMatrix) ClassMetrics() []ClassMetrics {
+	n := c.NumClasses()
+	result := make([]ClassMetrics, n)
+	for k := 0; k < n; k++ {
+		tp := c.Counts[k][k]
+		actual, predicted := 0, 0
+		for i := 0; i < n; i++ {
+			actual += c.Counts[k][i]
+			predicted += c.Counts[i][k]
+		}
+
+		m := ClassMetrics{Class: k, Support: actual}
+		if predicted > 0 {
+			m.Precision = float64(tp) / float64(predicted)
+		}
+		if actual > 0 {
+			m.Recall = float64(tp) / float64(actual)
+		}
+		if m.Precision+m.Recall > 0 {
+			m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+		}
+		result[k] = m
+	}
+	return result
+}
+
+// TopConfusions returns up to limit off-diagonal cells with a non-zero count, most frequent first.
+// Ties are ordered by actual and then predicted label.
+func (c *ConfusionMatrix) TopConfusions(limit int) []Confusion {
+	var result []Confusion
+	for i, row := range c.Counts {
+		for j, count := range row {
+			if i != j && count > 0 {
+				result = append(result, Confusion{Actual: i, Predicted: j, Count: count})
+			}
+		}
+	}
+	sort.SliceStable(result, func(a, b int) bool {
+		return result[a].Count > result[b].Count
+	})
+	if limit >= 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// Report computes the per-class metrics together with their macro and weighted averages.
+func (c *ConfusionMatrix) Report() *Report {
+	classes := c.ClassMetrics()
+	r := &Report{
+		Accuracy:        c.Accuracy(),
+		Total:           c.Total(),
+		Classes:         classes,
+		TopConfusions:   c.TopConfusions(10),
+		ConfusionMatrix: c.Counts,
+	}
+
+	if len(classes) > 0 {
+		for _, m := range classes {
+			r.MacroAverage.Precision += m.Precision
+			r.MacroAverage.Recall += m.Recall
+			r.MacroAverage.F1 += m.F1
+		}
+		n := float64(len(classes))
+		r.MacroAverage.Precision /= n
+		r.MacroAverage.Recall /= n
+		r.MacroAverage.F1 /= n
+	}
+
+	if r.Total > 0 {
+		for _, m := range classes {
+			w := float64(m.Support) / float64(r.Total)
+			r.WeightedAverage.Precision += w * m.Precision
+			r.WeightedAverage.Recall += w * m.Recall
+			r.WeightedAverage.F1 += w * m.F1
+		}
+	}
+
+	return r
+}
+
+// WriteText prints the confusion matrix, the per-class table and the averages in a human-readable layout.
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Confusion Matrix (rows: actual, columns: predicted)")
+	fmt.Fprint(w, "      ")
+	for j := range r.ConfusionMatrix {
+		fmt.Fprintf(w, "%6d", j)
+	}
+	fmt.Fprintln(w)
+	for i, row := range r.ConfusionMatrix {
+		fmt.Fprintf(w, "%6d", i)
+		for _, count := range row {
+			fmt.Fprintf(w, "%6d", count)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-14s %10s %10s %10s %10s\n", "Class", "Precision", "Recall", "F1", "Support")
+	for _, m := range r.Classes {
+		fmt.Fprintf(w, "%-14d %10.4f %10.4f %10.4f %10d\n", m.Class, m.Precision, m.Recall, m.F1, m.Support)
+	}
+	fmt.Fprintf(w, "%-14s %10.4f %10.4f %10.4f %10d\n", "macro avg", r.MacroAverage.Precision, r.MacroAverage.Recall, r.MacroAverage.F1, r.Total)
+	fmt.Fprintf(w, "%-14s %10.4f %10.4f %10.4f %10d\n", "weighted avg", r.WeightedAverage.Precision, r.WeightedAverage.Recall, r.WeightedAverage.F1, r.Total)
+
+	if len(r.TopConfusions) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Most Frequent Confusions")
+		for _, c := range r.TopConfusions {
+			fmt.Fprintf(w, "  %d -> %d: %d\n", c.Actual, c.Predicted, c.Count)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestConfusionMatrix(t *testing.T) {
+	c := NewConfusionMatrix(3)
+	pairs := [][2]int{{0, 0}, {0, 0}, {1, 1}, {1, 2}, {2, 2}, {2, 0}, {5, 1}}
+	for _, p := range pairs {
+		c.Add(p[0], p[1])
+	}
+
+	if c.NumClasses() != 3 {
+		t.Errorf("Expected 3 classes, got %d", c.NumClasses())
+	}
+	// The out-of-range pair (5, 1) must be ignored
+	if c.Total() != 6 {
+		t.Errorf("Expected 6 recorded predictions, got %d", c.Total())
+	}
+	if c.Counts[1][2] != 1 || c.Counts[0][0] != 2 {
+		t.Errorf("Unexpected counts: %v", c.Counts)
+	}
+	if got := c.Accuracy(); math.Abs(got-4.0/6.0) > 1e-12 {
+		t.Errorf("Accuracy: expected %f, got %f", 4.0/6.0, got)
+	}
+	if c.Max() != 2 {
+		t.Errorf("Max: expected 2, got %d", c.Max())
+	}
+
+	if NewConfusionMatrix(10).Accuracy() != 0 {
+		t.Error("Accuracy of an empty matrix should be 0")
+	}
+}
+
+func TestReport(t *testing.T) {
+	// Class 0: 3 correct, 1 predicted as 1
+	// Class 1: 1 correct
+	// Class 2: no samples, predicted once for a class 1 sample
+	c := NewConfusionMatrix(3)
+	for _, p := range [][2]int{{0, 0}, {0, 0}, {0, 0}, {0, 1}, {1, 1}, {1, 2}} {
+		c.Add(p[0], p[1])
+	}
+	r := c.Report()
+
+	expected := []ClassMetrics{
+		{Class: 0, Precision: 1, Recall: 0.75, F1: 2 * 0.75 / 1.75, Support: 4},
+		{Class: 1, Precision: 0.5, Recall: 0.5, F1: 0.5, Support: 2},
+		{Class: 2, Precision: 0, Recall: 0, F1: 0, Support: 0},
+	}
+	for i, want := range expected {
+		got := r.Classes[i]
+		if got.Class != want.Class || got.Support != want.Support ||
+			math.Abs(got.Precision-want.Precision) > 1e-12 ||
+			math.Abs(got.Recall-want.Recall) > 1e-12 ||
+			math.Abs(got.F1-want.F1) > 1e-12 {
+			t.Errorf("Class %d metrics mismatch.\nExpected: %+v\nGot: %+v", i, want, got)
+		}
+	}
+
+	macroF1 := (expected[0].F1 + expected[1].F1) / 3
+	if math.Abs(r.MacroAverage.F1-macroF1) > 1e-12 {
+		t.Errorf("Macro F1: expected %f, got %f", macroF1, r.MacroAverage.F1)
+	}
+	weightedRecall := (4*0.75 + 2*0.5) / 6
+	if math.Abs(r.WeightedAverage.Recall-weightedRecall) > 1e-12 {
+		t.Errorf("Weighted recall: expected %f, got %f", weightedRecall, r.WeightedAverage.Recall)
+	}
+	// Weighted recall always equals accuracy
+	if math.Abs(r.WeightedAverage.Recall-r.Accuracy) > 1e-12 {
+		t.Errorf("Weighted recall %f should equal accuracy %f", r.WeightedAverage.Recall, r.Accuracy)
+	}
+
+	if len(r.TopConfusions) != 2 || r.TopConfusions[0] != (Confusion{Actual: 0, Predicted: 1, Count: 1}) {
+		t.Errorf("Unexpected top confusions: %+v", r.TopConfusions)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Report should be JSON serializable: %v", err)
+	}
+	for _, key := range []string{`"macro_average"`, `"weighted_average"`, `"confusion_matrix"`, `"support"`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("JSON report is missing %s", key)
+		}
+	}
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	if !strings.Contains(buf.String(), "weighted avg") || !strings.Contains(buf.String(), "0 -> 1: 1") {
+		t.Errorf("Unexpected text report:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,58 @@
+// Package logging configures the structured log/slog logger shared by the commands.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Options holds the logging flags of a command.
+type Options struct {
+	Format string // "text" or "json"
+	Level  string // "debug", "info", "warn" or "error"
+}
+
+// RegisterFlags registers -log-format and -log-level on fs.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Format, "log-format", "text", "Log output format: text or json")
+	fs.StringVar(&o.Level, "log-level", "info", "Minimum log level: debug, info, warn or error")
+}
+
+// Setup installs a logger configured by o writing to stderr as the default slog logger.
+// The standard log package writes through it as well.
+func (o Options) Setup() error {
+	logger, err := New(os.Stderr, o.Format, o.Level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// New returns a logger writing to w in format "text" or "json" that drops records below level.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (expected text or json)", format)
+	}
+}
+
+// Fatal logs msg with args at error level and exits with status 1.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("hidden")
+	logger.Info("epoch finished", "epoch", 3)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 record above the debug level, got %d: %q", len(lines), buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", lines[0], err)
+	}
+	if record["msg"] != "epoch finished" || record["epoch"] != 3.0 || record["level"] != "INFO" {
+		t.Errorf("Unexpected record: %v", record)
+	}
+}
+
+func TestNewLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "text", "DEBUG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("shown")
+	if !strings.Contains(buf.String(), "level=DEBUG msg=shown") {
+		t.Errorf("Expected a text debug record, got %q", buf.String())
+	}
+
+	if _, err := New(&buf, "xml", "info"); err == nil {
+		t.Error("An unknown format should fail")
+	}
+	if _, err := New(&buf, "text", "verbose"); err == nil {
+		t.Error("An unknown level should fail")
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-log-format", "json", "-log-level", "warn"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Format != "json" || opts.Level != "warn" {
+		t.Errorf("Expected json/warn, got %s/%s", opts.Format, opts.Level)
+	}
+}
@@ -2,27 +2,90 @@ package matrix
 
 import (
 	"fmt"
+	"math"
 	"sync"
 )
 
+// Float is the set of element types a matrix can hold.
+type Float interface {
+	~float32 | ~float64
+}
+
+// Dense is a 2D slice of floating point values in either precision.
+type Dense[T Float] [][]T
+
 // Matrix type is an alias for a 2D slice of float64
-type Matrix [][]float64
+type Matrix = Dense[float64]
+
+// Matrix32 type is an alias for a 2D slice of float32.
+// It halves memory bandwidth compared to Matrix.
+type Matrix32 = Dense[float32]
+
+// Adaptive Parallelism Threshold
+// For small batch sizes (like single inference), the overhead of goroutines outweighs the benefits.
+const parallelThreshold = 4
 
 // NewMatrix creates and returns a new Matrix with the given number of rows and columns.
 // All elements are initialized to 0.0.
 func NewMatrix(rows, cols int) Matrix {
-	m := make(Matrix, rows)
+	return New[float64](rows, cols)
+}
+
+// NewMatrix32 creates and returns a new float32 Matrix32 with the given number of rows and columns.
+func NewMatrix32(rows, cols int) Matrix32 {
+	return New[float32](rows, cols)
+}
+
+// New creates and returns a new matrix of element type T with all elements set to zero.
+func New[T Float](rows, cols int) Dense[T] {
+	m := make(Dense[T], rows)
 	for i := range m {
-		m[i] = make([]float64, cols)
+		m[i] = make([]T, cols)
 	}
 	return m
 }
 
+// Convert returns a copy of the matrix with every element converted to U.
+func Convert[U, T Float](m Dense[T]) Dense[U] {
+	result := make(Dense[U], len(m))
+	for i, row := range m {
+		result[i] = make([]U, len(row))
+		for j, val := range row {
+			result[i][j] = U(val)
+		}
+	}
+	return result
+}
+
+// SizeBytes returns the memory needed for the matrix elements.
+func (m Dense[T]) SizeBytes() int {
+	elemSize := 8
+	if _, ok := any(T(0)).(float32); ok {
+		elemSize = 4
+	}
+	n := 0
+	for _, row := range m {
+		n += len(row)
+	}
+	return n * elemSize
+}
+
+// Norm returns the Frobenius (L2) norm of the matrix.
+func (m Dense[T]) Norm() float64 {
+	sum := 0.0
+	for _, row := range m {
+		for _, val := range row {
+			sum += float64(val) * float64(val)
+		}
+	}
+	return math.Sqrt(sum)
+}
+
 // ScalarMultiply multiplies each element of the matrix by a scalar value.
-func (m Matrix) ScalarMultiply(scalar float64) Matrix {
+func (m Dense[T]) ScalarMultiply(scalar T) Dense[T] {
 	rows := len(m)
 	cols := len(m[0])
-	result := NewMatrix(rows, cols)
+	result := New[T](rows, cols)
 	for i := 0; i < rows; i++ {
 		for j := 0; j < cols; j++ {
 			result[i][j] = m[i][j] * scalar
@@ -32,7 +95,7 @@ func (m Matrix) ScalarMultiply(scalar float64) Matrix {
 }
 
 // MultiplyElementWise performs element-wise multiplication of two matrices.
-func (a Matrix) MultiplyElementWise(b Matrix) (Matrix, error) {
+func (a Dense[T]) MultiplyElementWise(b Dense[T]) (Dense[T], error) {
 	rowsA := len(a)
 	colsA := len(a[0])
 	rowsB := len(b)
@@ -42,7 +105,7 @@ func (a Matrix) MultiplyElementWise(b Matrix) (Matrix, error) {
 		return nil, fmt.Errorf("incompatible dimensions for element-wise multiplication: %dx%d and %dx%d", rowsA, colsA, rowsB, colsB)
 	}
 
-	result := NewMatrix(rowsA, colsA)
+	result := New[T](rowsA, colsA)
 	for i := 0; i < rowsA; i++ {
 		for j := 0; j < colsA; j++ {
 			result[i][j] = a[i][j] * b[i][j]
@@ -52,7 +115,7 @@ func (a Matrix) MultiplyElementWise(b Matrix) (Matrix, error) {
 }
 
 // Transpose returns a new matrix that is the transpose of the current matrix.
-func (a Matrix) Transpose() Matrix {
+func (a Dense[T]) Transpose() Dense[T] {
 	rows := len(a)
 	cols := 0
 	if rows > 0 {
@@ -60,7 +123,7 @@ func (a Matrix) Transpose() Matrix {
 	}
 	
 
-	result := NewMatrix(cols, rows)
+	result := New[T](cols, rows)
 	for i := 0; i < rows; i++ {
 		for j := 0; j < cols; j++ {
 			result[j][i] = a[i][j]
@@ -70,10 +133,10 @@ func (a Matrix) Transpose() Matrix {
 }
 
 // Apply applies a function to each element of the matrix, returning a new matrix with the results.
-func (a Matrix) Apply(fn func(float64) float64) Matrix {
+func (a Dense[T]) Apply(fn func(T) T) Dense[T] {
 	rows := len(a)
 	cols := len(a[0])
-	result := NewMatrix(rows, cols)
+	result := New[T](rows, cols)
 	for i := 0; i < rows; i++ {
 		for j := 0; j < cols; j++ {
 			result[i][j] = fn(a[i][j])
@@ -84,7 +147,7 @@ func (a Matrix) Apply(fn func(float64) float64) Matrix {
 
 // Subtract performs element-wise subtraction between the current matrix and another matrix (b).
 // It returns a new matrix with the result or an error if dimensions are incompatible.
-func (a Matrix) Subtract(b Matrix) (Matrix, error) {
+func (a Dense[T]) Subtract(b Dense[T]) (Dense[T], error) {
 	rowsA := len(a)
 	colsA := len(a[0])
 	rowsB := len(b)
@@ -94,7 +157,7 @@ func (a Matrix) Subtract(b Matrix) (Matrix, error) {
 		return nil, fmt.Errorf("incompatible dimensions for subtraction: %dx%d and %dx%d", rowsA, colsA, rowsB, colsB)
 	}
 
-	result := NewMatrix(rowsA, colsA)
+	result := New[T](rowsA, colsA)
 	for i := 0; i < rowsA; i++ {
 		for j := 0; j < colsA; j++ {
 			result[i][j] = a[i][j] - b[i][j]
@@ -105,7 +168,7 @@ func (a Matrix) Subtract(b Matrix) (Matrix, error) {
 
 // Add performs element-wise addition between the current matrix and another matrix (b).
 // It returns a new matrix with the result or an error if dimensions are incompatible.
-func (a Matrix) Add(b Matrix) (Matrix, error) {
+func (a Dense[T]) Add(b Dense[T]) (Dense[T], error) {
 	rowsA := len(a)
 	colsA := len(a[0])
 	rowsB := len(b)
@@ -115,7 +178,7 @@ func (a Matrix) Add(b Matrix) (Matrix, error) {
 		return nil, fmt.Errorf("incompatible dimensions for addition: %dx%d and %dx%d", rowsA, colsA, rowsB, colsB)
 	}
 
-	result := NewMatrix(rowsA, colsA)
+	result := New[T](rowsA, colsA)
 	for i := 0; i < rowsA; i++ {
 		for j := 0; j < colsA; j++ {
 			result[i][j] = a[i][j] + b[i][j]
@@ -124,9 +187,33 @@ func (a Matrix) Add(b Matrix) (Matrix, error) {
 	return result, nil
 }
 
+// AddRowVector adds the 1xN matrix b to every row of the current matrix, as needed for
+// adding a bias to a batch of inputs. It returns an error if the column counts differ.
+func (a Dense[T]) AddRowVector(b Dense[T]) (Dense[T], error) {
+	if len(b) != 1 {
+		return nil, fmt.Errorf("expected a row vector, got %d rows", len(b))
+	}
+	rowsA := len(a)
+	colsA := 0
+	if rowsA > 0 {
+		colsA = len(a[0])
+	}
+	if colsA != len(b[0]) {
+		return nil, fmt.Errorf("incompatible dimensions for row vector addition: %dx%d and 1x%d", rowsA, colsA, len(b[0]))
+	}
+
+	result := New[T](rowsA, colsA)
+	for i := 0; i < rowsA; i++ {
+		for j := 0; j < colsA; j++ {
+			result[i][j] = a[i][j] + b[0][j]
+		}
+	}
+	return result, nil
+}
+
 // DotProduct performs matrix multiplication between the current matrix and another matrix (B).
 // It returns a new matrix with the result or an error if dimensions are incompatible.
-func (a Matrix) DotProduct(b Matrix) (Matrix, error) {
+func (a Dense[T]) DotProduct(b Dense[T]) (Dense[T], error) {
 	rowsA := len(a)
 	colsA := 0
 	if rowsA > 0 {
@@ -142,17 +229,13 @@ func (a Matrix) DotProduct(b Matrix) (Matrix, error) {
 		return nil, fmt.Errorf("incompatible dimensions for dot product: %dx%d and %dx%d", rowsA, colsA, rowsB, colsB)
 	}
 
-	result := NewMatrix(rowsA, colsB)
-	
-	// Adaptive Parallelism Threshold
-	// For small batch sizes (like single inference), the overhead of goroutines outweighs the benefits.
-	const parallelThreshold = 4
+	result := New[T](rowsA, colsB)
 
 	if rowsA < parallelThreshold {
 		// Sequential execution for small matrices
 		for i := 0; i < rowsA; i++ {
 			for j := 0; j < colsB; j++ {
-				sum := 0.0
+				var sum T
 				for k := 0; k < colsA; k++ {
 					sum += a[i][k] * b[k][j]
 				}
@@ -167,7 +250,7 @@ func (a Matrix) DotProduct(b Matrix) (Matrix, error) {
 			go func(rowIdx int) {
 				defer wg.Done()
 				for j := 0; j < colsB; j++ {
-					sum := 0.0
+					var sum T
 					for k := 0; k < colsA; k++ {
 						sum += a[rowIdx][k] * b[k][j]
 					}
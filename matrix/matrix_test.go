@@ -72,31 +72,81 @@ func TestDotProduct(t *testing.T) {
 }
 
 func BenchmarkDotProduct(b *testing.B) {
+	benchmarkDotProduct[float64](b)
+}
+
+func BenchmarkDotProduct32(b *testing.B) {
+	benchmarkDotProduct[float32](b)
+}
+
+// benchmarkDotProduct reports the throughput of a training-sized multiplication in precision T.
+func benchmarkDotProduct[T Float](b *testing.B) {
 	// Simulate input layer -> hidden layer multiplication
 	// Input: 64 batch size x 784 features
 	// Weights: 784 features x 200 hidden neurons
 	rowsA, colsA := 64, 784
 	rowsB, colsB := 784, 200
 
-	m1 := NewMatrix(rowsA, colsA)
-	m2 := NewMatrix(rowsB, colsB)
+	m1 := New[T](rowsA, colsA)
+	m2 := New[T](rowsB, colsB)
 
 	// Initialize with some values to avoid compiler optimizations skipping work
 	for i := 0; i < rowsA; i++ {
 		for j := 0; j < colsA; j++ {
-			m1[i][j] = float64(i + j)
+			m1[i][j] = T(i + j)
 		}
 	}
 	for i := 0; i < rowsB; i++ {
 		for j := 0; j < colsB; j++ {
-			m2[i][j] = float64(i - j)
+			m2[i][j] = T(i - j)
 		}
 	}
 
+	// Bytes read from both operands per multiplication
+	b.SetBytes(int64(m1.SizeBytes() + m2.SizeBytes()))
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = m1.DotProduct(m2)
 	}
+	b.ReportMetric(float64(b.N*rowsA)/b.Elapsed().Seconds(), "rows/s")
+}
+
+func TestDotProduct32(t *testing.T) {
+	a := Matrix32{{1, 2}, {3, 4}}
+	b := Matrix32{{5, 6}, {7, 8}}
+	expected := Matrix32{{19, 22}, {43, 50}}
+	result, err := a.DotProduct(b)
+	if err != nil {
+		t.Errorf("DotProduct returned an unexpected error: %v", err)
+	}
+	if !equalMatrices(Convert[float64](result), Convert[float64](expected)) {
+		t.Errorf("DotProduct float32 result mismatch.\nExpected: %v\nGot: %v", expected, result)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	m := Matrix{{1.5, -2.25}, {0, 3}}
+	m32 := Convert[float32](m)
+	if _, ok := any(m32[0][0]).(float32); !ok {
+		t.Fatalf("Convert[float32] produced %T elements", m32[0][0])
+	}
+	back := Convert[float64](m32)
+	if !equalMatrices(back, m) {
+		t.Errorf("Convert round trip mismatch.\nExpected: %v\nGot: %v", m, back)
+	}
+
+	// Convert must copy, not alias
+	back[0][0] = 42
+	if m[0][0] == 42 {
+		t.Error("Convert should return a copy of the input matrix")
+	}
+
+	if got := m.SizeBytes(); got != 32 {
+		t.Errorf("float64 SizeBytes: expected 32, got %d", got)
+	}
+	if got := m32.SizeBytes(); got != 16 {
+		t.Errorf("float32 SizeBytes: expected 16, got %d", got)
+	}
 }
 
 func TestAdd(t *testing.T) {
@@ -122,6 +172,27 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestAddRowVector(t *testing.T) {
+	a := Matrix{{1, 2}, {3, 4}, {5, 6}}
+	b := Matrix{{10, 20}}
+	expected := Matrix{{11, 22}, {13, 24}, {15, 26}}
+	result, err := a.AddRowVector(b)
+
+	if err != nil {
+		t.Errorf("AddRowVector returned an unexpected error: %v", err)
+	}
+	if !equalMatrices(result, expected) {
+		t.Errorf("AddRowVector result mismatch.\nExpected: %v\nGot: %v", expected, result)
+	}
+
+	if _, err := a.AddRowVector(Matrix{{1, 2, 3}}); err == nil {
+		t.Error("AddRowVector should return an error for incompatible dimensions, but didn't")
+	}
+	if _, err := a.AddRowVector(Matrix{{1, 2}, {3, 4}}); err == nil {
+		t.Error("AddRowVector should return an error for a matrix with more than one row, but didn't")
+	}
+}
+
 func TestSubtract(t *testing.T) {
 	// Test case 1: Valid subtraction
 	a := Matrix{{5, 6}, {7, 8}}
@@ -192,6 +263,16 @@ func TestTranspose(t *testing.T) {
 	}
 }
 
+func TestNorm(t *testing.T) {
+	m := Matrix{{3, 0}, {0, -4}}
+	if got := m.Norm(); math.Abs(got-5) > 1e-12 {
+		t.Errorf("Norm: expected 5, got %f", got)
+	}
+	if got := NewMatrix(2, 2).Norm(); got != 0 {
+		t.Errorf("Norm of zero matrix: expected 0, got %f", got)
+	}
+}
+
 // Helper function to compare two matrices for equality with a small tolerance for float comparisons
 func equalMatrices(m1, m2 Matrix) bool {
 	if len(m1) != len(m2) {
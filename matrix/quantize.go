@@ -0,0 +1,160 @@
+package matrix
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// QuantizedMatrix holds an int8 copy of a weight matrix.
+// Quantization is symmetric and per-channel: every column j has its own scale,
+// and the original value is approximately float64(Data[i][j]) * Scales[j].
+type QuantizedMatrix struct {
+	Data   [][]int8
+	Scales []float64
+}
+
+// Quantize converts a matrix to int8 using one symmetric scale per column.
+// A column whose values are all zero gets a scale of 0.
+func Quantize[T Float](m Dense[T]) *QuantizedMatrix {
+	rows := len(m)
+	cols := 0
+	if rows > 0 {
+		cols = len(m[0])
+	}
+
+	scales := make([]float64, cols)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			if abs := math.Abs(float64(m[i][j])); abs > scales[j] {
+				scales[j] = abs
+			}
+		}
+	}
+	for j := range scales {
+		scales[j] /= math.MaxInt8
+	}
+
+	data := make([][]int8, rows)
+	for i := 0; i < rows; i++ {
+		data[i] = make([]int8, cols)
+		for j := 0; j < cols; j++ {
+			data[i][j] = quantizeValue(float64(m[i][j]), scales[j])
+		}
+	}
+
+	return &QuantizedMatrix{Data: data, Scales: scales}
+}
+
+// QuantizeVector converts a vector to int8 using a single symmetric scale.
+// It is used for activations, which are quantized on the fly per input row.
+func QuantizeVector[T Float](v []T) ([]int8, float64) {
+	scale := 0.0
+	for _, val := range v {
+		if abs := math.Abs(float64(val)); abs > scale {
+			scale = abs
+		}
+	}
+	scale /= math.MaxInt8
+
+	q := make([]int8, len(v))
+	for i, val := range v {
+		q[i] = quantizeValue(float64(val), scale)
+	}
+	return q, scale
+}
+
+// quantizeValue rounds val/scale to the nearest int8, clamping to [-127, 127].
+func quantizeValue(val, scale float64) int8 {
+	if scale == 0 {
+		return 0
+	}
+	r := math.Round(val / scale)
+	if r > math.MaxInt8 {
+		r = math.MaxInt8
+	} else if r < -math.MaxInt8 {
+		r = -math.MaxInt8
+	}
+	return int8(r)
+}
+
+// Rows returns the number of rows in the quantized matrix.
+func (q *QuantizedMatrix) Rows() int {
+	return len(q.Data)
+}
+
+// Cols returns the number of columns in the quantized matrix.
+func (q *QuantizedMatrix) Cols() int {
+	return len(q.Scales)
+}
+
+// Dequantize converts the quantized matrix back to float64.
+func (q *QuantizedMatrix) Dequantize() Matrix {
+	result := NewMatrix(q.Rows(), q.Cols())
+	for i, row := range q.Data {
+		for j, val := range row {
+			result[i][j] = float64(val) * q.Scales[j]
+		}
+	}
+	return result
+}
+
+// SizeBytes returns the memory needed for the int8 data and the float64 scales.
+func (q *QuantizedMatrix) SizeBytes() int {
+	return q.Rows()*q.Cols() + 8*len(q.Scales)
+}
+
+// QuantizedDotProduct multiplies the current matrix by a quantized matrix (b).
+// Each row of the current matrix is quantized to int8, the products are
+// accumulated in int32, and the result is rescaled back to T.
+func (a Dense[T]) QuantizedDotProduct(b *QuantizedMatrix) (Dense[T], error) {
+	rowsA := len(a)
+	colsA := 0
+	if rowsA > 0 {
+		colsA = len(a[0])
+	}
+	rowsB := b.Rows()
+	colsB := b.Cols()
+
+	if colsA != rowsB {
+		return nil, fmt.Errorf("incompatible dimensions for quantized dot product: %dx%d and %dx%d", rowsA, colsA, rowsB, colsB)
+	}
+
+	result := New[T](rowsA, colsB)
+
+	computeRow := func(rowIdx int) {
+		xq, xScale := QuantizeVector(a[rowIdx])
+		acc := make([]int32, colsB)
+		for k, xv := range xq {
+			// MNIST inputs are mostly background, so zero activations are skipped.
+			if xv == 0 {
+				continue
+			}
+			x := int32(xv)
+			for j, wv := range b.Data[k] {
+				acc[j] += x * int32(wv)
+			}
+		}
+		for j, sum := range acc {
+			result[rowIdx][j] = T(float64(sum) * xScale * b.Scales[j])
+		}
+	}
+
+	if rowsA < parallelThreshold {
+		for i := 0; i < rowsA; i++ {
+			computeRow(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i := 0; i < rowsA; i++ {
+			wg.Add(1)
+			go func(rowIdx int) {
+				defer wg.Done()
+				computeRow(rowIdx)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package matrix
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	m := Matrix{{1.0, -0.5, 0}, {-2.0, 0.25, 0}}
+	q := Quantize(m)
+
+	if q.Rows() != 2 || q.Cols() != 3 {
+		t.Fatalf("Expected 2x3 quantized matrix, got %dx%d", q.Rows(), q.Cols())
+	}
+
+	// Per-channel scales are max(|column|) / 127
+	expectedScales := []float64{2.0 / 127, 0.5 / 127, 0}
+	for j, s := range expectedScales {
+		if math.Abs(q.Scales[j]-s) > 1e-12 {
+			t.Errorf("Scale %d: expected %f, got %f", j, s, q.Scales[j])
+		}
+	}
+
+	// The largest magnitude in each column maps to +-127
+	if q.Data[1][0] != -127 || q.Data[0][1] != -127 {
+		t.Errorf("Column maxima should quantize to -127, got %d and %d", q.Data[1][0], q.Data[0][1])
+	}
+
+	// All-zero columns stay zero
+	if q.Data[0][2] != 0 || q.Data[1][2] != 0 {
+		t.Errorf("Zero column should quantize to 0, got %v", q.Data)
+	}
+
+	// Round trip error is bounded by half a quantization step
+	d := q.Dequantize()
+	for i := range m {
+		for j := range m[i] {
+			if math.Abs(d[i][j]-m[i][j]) > q.Scales[j]/2+1e-12 {
+				t.Errorf("Dequantized (%d, %d): expected %f, got %f", i, j, m[i][j], d[i][j])
+			}
+		}
+	}
+}
+
+func TestQuantizedDotProduct(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a := NewMatrix(5, 40)
+	b := NewMatrix(40, 8)
+	for i := range a {
+		for j := range a[i] {
+			a[i][j] = r.Float64()
+		}
+	}
+	for i := range b {
+		for j := range b[i] {
+			b[i][j] = r.NormFloat64()
+		}
+	}
+
+	expected, err := a.DotProduct(b)
+	if err != nil {
+		t.Fatalf("DotProduct returned an unexpected error: %v", err)
+	}
+	result, err := a.QuantizedDotProduct(Quantize(b))
+	if err != nil {
+		t.Fatalf("QuantizedDotProduct returned an unexpected error: %v", err)
+	}
+
+	for i := range expected {
+		for j := range expected[i] {
+			// int8 has roughly two significant digits, so allow a loose relative error
+			if math.Abs(result[i][j]-expected[i][j]) > 0.05*math.Max(1, math.Abs(expected[i][j])) {
+				t.Errorf("QuantizedDotProduct (%d, %d): expected %f, got %f", i, j, expected[i][j], result[i][j])
+			}
+		}
+	}
+
+	// Incompatible dimensions
+	_, err = Matrix{{1, 2, 3}}.QuantizedDotProduct(Quantize(Matrix{{4}, {5}}))
+	if err == nil {
+		t.Error("QuantizedDotProduct should return an error for incompatible dimensions, but didn't")
+	}
+}
+
+func BenchmarkQuantizedDotProduct(b *testing.B) {
+	// Single inference: 1 x 784 input against 784 x 200 hidden weights
+	m1 := NewMatrix(1, 784)
+	m2 := NewMatrix(784, 200)
+	for j := 0; j < 784; j++ {
+		m1[0][j] = float64(j%7) / 7
+	}
+	for i := 0; i < 784; i++ {
+		for j := 0; j < 200; j++ {
+			m2[i][j] = float64(i-j) / 784
+		}
+	}
+	q := Quantize(m2)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = m1.QuantizedDotProduct(q)
+	}
+}
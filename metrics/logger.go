@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Scope values for Record.Scope
+const (
+	ScopeEpoch = "epoch" // Record summarizes a whole epoch, including validation
+	ScopeStep  = "step"  // Record summarizes the batches since the previous step record
+)
+
+// Record holds the training metrics of one epoch, or of a window of steps within an epoch.
+// Validation fields are nil when nothing was validated: always for step records, and for
+// epoch records of runs without validation data.
+type Record struct {
+	Scope          string   `json:"scope"`
+	Epoch          int      `json:"epoch"`
+	Step           int      `json:"step"` // Global batch count since the start of training
+	TrainLoss      float64  `json:"train_loss"`
+	TrainAccuracy  float64  `json:"train_accuracy"`
+	ValLoss        *float64 `json:"val_loss,omitempty"`
+	ValAccuracy    *float64 `json:"val_accuracy,omitempty"`
+	LearningRate   float64  `json:"learning_rate"`
+	GradNorm       float64  `json:"grad_norm"` // Mean per-sample gradient norm
+	W1Norm         float64  `json:"w1_norm"`
+	W2Norm         float64  `json:"w2_norm"`
+	ElapsedSeconds float64  `json:"elapsed_seconds"` // Since the start of training
+	SamplesPerSec  float64  `json:"samples_per_sec"`
+}
+
+// csvHeader lists the CSV columns in the same order as the Record fields.
+var csvHeader = []string{
+	"scope", "epoch", "step", "train_loss", "train_accuracy", "val_loss", "val_accuracy",
+	"learning_rate", "grad_norm", "w1_norm", "w2_norm", "elapsed_seconds", "samples_per_sec",
+}
+
+// Float returns a pointer to v, for the optional fields of a Record.
+func Float(v float64) *float64 {
+	return &v
+}
+
+// Format selects the on-disk encoding of a metrics log.
+type Format int
+
+const (
+	CSV   Format = iota // Comma-separated values with a header row
+	JSONL               // One JSON object per line
+)
+
+// ParseFormat converts "csv" or "jsonl" into a Format.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return CSV, nil
+	case "jsonl", "json":
+		return JSONL, nil
+	default:
+		return 0, fmt.Errorf("unknown metrics format %q (expected csv or jsonl)", name)
+	}
+}
+
+// FormatFromPath infers the Format from a file extension, defaulting to CSV.
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".json":
+		return JSONL
+	default:
+		return CSV
+	}
+}
+
+// Logger writes one Record per call to Log.
+type Logger struct {
+	format    Format
+	closer    io.Closer
+	csv       *csv.Writer
+	json      *json.Encoder
+	wroteHead bool
+}
+
+// NewLogger creates a Logger that writes records to w in the given format.
+func NewLogger(w io.Writer, format Format) *Logger {
+	l := &Logger{format: format}
+	switch format {
+	case JSONL:
+		l.json = json.NewEncoder(w)
+	default:
+		l.csv = csv.NewWriter(w)
+	}
+	return l
+}
+
+// Create creates (or truncates) the file at path and returns a Logger writing to it.
+func Create(path string, format Format) (*Logger, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	l := NewLogger(file, format)
+	l.closer = file
+	return l, nil
+}
+
+// Log writes a single record. Records are flushed immediately so a crashed run still leaves a usable log.
+func (l *Logger) Log(r Record) error {
+	if l.json != nil {
+		if err := l.json.Encode(r); err != nil {
+			return fmt.Errorf("failed to write metrics record: %w", err)
+		}
+		return nil
+	}
+
+	if !l.wroteHead {
+		if err := l.csv.Write(csvHeader); err != nil {
+			return fmt.Errorf("failed to write metrics header: %w", err)
+		}
+		l.wroteHead = true
+	}
+	if err := l.csv.Write(r.csvRow()); err != nil {
+		return fmt.Errorf("failed to write metrics record: %w", err)
+	}
+	l.csv.Flush()
+	return l.csv.Error()
+}
+
+// Close flushes pending output and closes the underlying file, if the Logger owns one.
+func (l *Logger) Close() error {
+	if l.csv != nil {
+		l.csv.Flush()
+		if err := l.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if l.closer != nil {
+		return l.closer.Close()
+	}
+	return nil
+}
+
+// csvRow formats the record as CSV fields. Validation columns are left empty if not measured.
+func (r Record) csvRow() []string {
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	opt := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return f(*v)
+	}
+	return []string{
+		r.Scope, strconv.Itoa(r.Epoch), strconv.Itoa(r.Step),
+		f(r.TrainLoss), f(r.TrainAccuracy), opt(r.ValLoss), opt(r.ValAccuracy),
+		f(r.LearningRate), f(r.GradNorm), f(r.W1Norm), f(r.W2Norm),
+		f(r.ElapsedSeconds), f(r.SamplesPerSec),
+	}
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoggerCSV(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, CSV)
+
+	records := []Record{
+		{Scope: ScopeStep, Epoch: 1, Step: 100, TrainLoss: 0.5, TrainAccuracy: 0.8, LearningRate: 0.3},
+		{Scope: ScopeEpoch, Epoch: 1, Step: 938, TrainLoss: 0.4, ValLoss: Float(0.35), ValAccuracy: Float(0.9), LearningRate: 0.3},
+	}
+	for _, r := range records {
+		if err := l.Log(r); err != nil {
+			t.Fatalf("Log returned an unexpected error: %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close returned an unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d lines:\n%s", len(lines), buf.String())
+	}
+	if lines[0] != strings.Join(csvHeader, ",") {
+		t.Errorf("Header mismatch: got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "step,1,100,0.5,0.8,,,0.3,") {
+		t.Errorf("Step row should leave validation columns empty, got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "epoch,1,938,0.4,0,0.35,0.9,0.3,") {
+		t.Errorf("Epoch row mismatch, got %q", lines[2])
+	}
+}
+
+func TestLoggerJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, JSONL)
+
+	// A validation loss of 0 is kept, unlike the unmeasured validation of a step record
+	want := Record{Scope: ScopeEpoch, Epoch: 2, Step: 10, TrainLoss: 0.1, ValLoss: Float(0), ValAccuracy: Float(0.97), SamplesPerSec: 1234.5}
+	if err := l.Log(want); err != nil {
+		t.Fatalf("Log returned an unexpected error: %v", err)
+	}
+	if err := l.Log(want); err != nil {
+		t.Fatalf("Log returned an unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 JSON lines, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], `"val_loss":0,`) {
+		t.Errorf("Expected a validation loss of 0 in the JSON line, got %s", lines[0])
+	}
+	var got Record
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("Failed to decode JSON line: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Record mismatch.\nExpected: %+v\nGot: %+v", want, got)
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected Format
+	}{
+		{"metrics.csv", CSV},
+		{"run/metrics.jsonl", JSONL},
+		{"metrics.JSON", JSONL},
+		{"metrics", CSV},
+	}
+	for _, tt := range tests {
+		if got := FormatFromPath(tt.path); got != tt.expected {
+			t.Errorf("FormatFromPath(%q): expected %v, got %v", tt.path, tt.expected, got)
+		}
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat should reject unknown formats")
+	}
+}
+
+func TestReadRoundTrip(t *testing.T) {
+	records := []Record{
+		{Scope: ScopeStep, Epoch: 1, Step: 50, TrainLoss: 0.7, TrainAccuracy: 0.78, LearningRate: 0.3, GradNorm: 1.6},
+		{Scope: ScopeEpoch, Epoch: 1, Step: 157, TrainLoss: 0.5, ValLoss: Float(0), ValAccuracy: Float(0.92), LearningRate: 0.3, ElapsedSeconds: 39.1, SamplesPerSec: 284.8},
+	}
+
+	for _, format := range []Format{CSV, JSONL} {
+		var buf bytes.Buffer
+		l := NewLogger(&buf, format)
+		for _, r := range records {
+			if err := l.Log(r); err != nil {
+				t.Fatalf("Log returned an unexpected error: %v", err)
+			}
+		}
+		l.Close()
+
+		got, err := Read(&buf, format)
+		if err != nil {
+			t.Fatalf("Read(format %d) returned an unexpected error: %v", format, err)
+		}
+		if len(got) != len(records) {
+			t.Fatalf("Read(format %d): expected %d records, got %d", format, len(records), len(got))
+		}
+		for i := range records {
+			if !reflect.DeepEqual(got[i], records[i]) {
+				t.Errorf("Read(format %d) record %d mismatch.\nExpected: %+v\nGot: %+v", format, i, records[i], got[i])
+			}
+		}
+	}
+}
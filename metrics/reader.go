@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ReadFile reads all records from a metrics log, inferring the format from the file extension.
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metrics file: %w", err)
+	}
+	defer file.Close()
+
+	return Read(file, FormatFromPath(path))
+}
+
+// Read reads all records written by a Logger in the given format.
+func Read(r io.Reader, format Format) ([]Record, error) {
+	if format == JSONL {
+		return readJSONL(r)
+	}
+	return readCSV(r)
+}
+
+func readJSONL(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse metrics line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	return records, nil
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// Map columns by header name so files with reordered or extra columns still load
+	columns := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+
+	records := make([]Record, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+		p := rowParser{row: row, columns: columns}
+		record := Record{
+			Scope:          p.str("scope"),
+			Epoch:          int(p.float("epoch")),
+			Step:           int(p.float("step")),
+			TrainLoss:      p.float("train_loss"),
+			TrainAccuracy:  p.float("train_accuracy"),
+			ValLoss:        p.optFloat("val_loss"),
+			ValAccuracy:    p.optFloat("val_accuracy"),
+			LearningRate:   p.float("learning_rate"),
+			GradNorm:       p.float("grad_norm"),
+			W1Norm:         p.float("w1_norm"),
+			W2Norm:         p.float("w2_norm"),
+			ElapsedSeconds: p.float("elapsed_seconds"),
+			SamplesPerSec:  p.float("samples_per_sec"),
+		}
+		if p.err != nil {
+			return nil, fmt.Errorf("failed to parse metrics row %d: %w", line+2, p.err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// rowParser reads named CSV columns and remembers the first parse error.
+type rowParser struct {
+	row     []string
+	columns map[string]int
+	err     error
+}
+
+func (p *rowParser) str(name string) string {
+	i, ok := p.columns[name]
+	if !ok || i >= len(p.row) {
+		return ""
+	}
+	return p.row[i]
+}
+
+// float parses a numeric column. Missing or empty columns read as 0.
+func (p *rowParser) float(name string) float64 {
+	s := p.str(name)
+	if s == "" || p.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		p.err = fmt.Errorf("column %s: %w", name, err)
+	}
+	return v
+}
+
+// optFloat parses an optional numeric column. Missing or empty columns read as nil.
+func (p *rowParser) optFloat(name string) *float64 {
+	if p.str(name) == "" {
+		return nil
+	}
+	return Float(p.float(name))
+}
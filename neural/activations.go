@@ -1,27 +1,32 @@
 package neural
 
-import "math"
+import (
+	"math"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+)
 
 // Sigmoid function
-func Sigmoid(x float64) float64 {
-	return 1.0 / (1.0 + math.Exp(-x))
+// It is evaluated in float64 and converted back to T.
+func Sigmoid[T matrix.Float](x T) T {
+	return T(1.0 / (1.0 + math.Exp(-float64(x))))
 }
 
 // SigmoidPrime calculates the derivative of the sigmoid function
-func SigmoidPrime(x float64) float64 {
+func SigmoidPrime[T matrix.Float](x T) T {
 	s := Sigmoid(x)
 	return s * (1 - s)
 }
 
-// Softmax applies the Softmax function to a slice of float64 values.
+// Softmax applies the Softmax function to a slice of float32 or float64 values.
 // It normalizes the values into a probability distribution.
-func Softmax(inputs []float64) []float64 {
+func Softmax[T matrix.Float](inputs []T) []T {
 	expSum := 0.0
-	outputs := make([]float64, len(inputs))
+	outputs := make([]T, len(inputs))
 
 	// Calculate exponentials and their sum
 	for _, input := range inputs {
-		expVal := math.Exp(input)
+		expVal := math.Exp(float64(input))
 		expSum += expVal
 		// Store expVal temporarily for later division.
 		// Note: This approach re-calculates math.Exp, which is slightly inefficient
@@ -33,7 +38,20 @@ func Softmax(inputs []float64) []float64 {
 
 	// Calculate softmax probabilities
 	for i, input := range inputs {
-		outputs[i] = math.Exp(input) / expSum
+		outputs[i] = T(math.Exp(float64(input)) / expSum)
 	}
 	return outputs
 }
+
+// CrossEntropy returns the cross-entropy loss between predicted probabilities and a one-hot target.
+// Probabilities are clamped away from zero so a confident mistake gives a large but finite loss.
+func CrossEntropy[T matrix.Float](probs, target []T) float64 {
+	const epsilon = 1e-12
+	loss := 0.0
+	for i, t := range target {
+		if t != 0 {
+			loss -= float64(t) * math.Log(math.Max(float64(probs[i]), epsilon))
+		}
+	}
+	return loss
+}
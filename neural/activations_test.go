@@ -88,3 +88,27 @@ func TestSoftmax(t *testing.T) {
 		}
 	}
 }
+
+func TestCrossEntropy(t *testing.T) {
+	tests := []struct {
+		probs    []float64
+		target   []float64
+		expected float64
+	}{
+		{[]float64{0.5, 0.5}, []float64{1, 0}, math.Log(2)},
+		{[]float64{0.1, 0.9}, []float64{0, 1}, -math.Log(0.9)},
+		{[]float64{1, 0}, []float64{1, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		result := CrossEntropy(tt.probs, tt.target)
+		if !almostEqual(result, tt.expected) {
+			t.Errorf("CrossEntropy(%v, %v): expected %f, got %f", tt.probs, tt.target, tt.expected, result)
+		}
+	}
+
+	// A zero probability on the true class must not produce +Inf
+	if loss := CrossEntropy([]float64{1, 0}, []float64{0, 1}); math.IsInf(loss, 0) || math.IsNaN(loss) {
+		t.Errorf("CrossEntropy with zero probability should be finite, got %f", loss)
+	}
+}
@@ -0,0 +1,63 @@
+package neural
+
+import (
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+)
+
+// Metadata describes how a model was trained. It is saved together with the weights;
+// models saved before metadata existed load with zero Metadata.
+type Metadata struct {
+	TrainedAt    time.Time     `json:"trained_at"`
+	Duration     time.Duration `json:"duration_ns"` // Wall-clock training time
+	Precision    string        `json:"precision"`   // float64 or float32
+	Epochs       int           `json:"epochs"`      // Epochs actually trained
+	BatchSize    int           `json:"batch_size"`
+	LearningRate float64       `json:"learning_rate"` // Initial learning rate
+	TrainSamples int           `json:"train_samples"`
+	TestAccuracy float64       `json:"test_accuracy"` // Fraction of test samples classified correctly after the last epoch
+	TestLoss     float64       `json:"test_loss"`
+	// Preprocessing pipeline applied to every input, in the form read by preprocess.Parse.
+	// Empty for models saved before pipelines were recorded.
+	Preprocess string `json:"preprocess,omitempty"`
+	// Augmentation applied to the training images, in the form read by augment.Parse. Empty if none.
+	Augment string `json:"augment,omitempty"`
+}
+
+// IsZero reports whether m holds no metadata, as for models saved without it.
+func (m Metadata) IsZero() bool {
+	return m == Metadata{}
+}
+
+// Architecture describes the layer sizes of a model.
+type Architecture struct {
+	InputSize  int    `json:"input_size"`
+	HiddenSize int    `json:"hidden_size"`
+	OutputSize int    `json:"output_size"`
+	Hidden     string `json:"hidden_activation"`
+	Output     string `json:"output_activation"`
+}
+
+// Architecture returns the layer sizes of the network, derived from its weights.
+func (net *Model[T]) Architecture() Architecture {
+	a := Architecture{Hidden: "sigmoid", Output: "softmax"}
+	if len(net.W1) > 0 {
+		a.InputSize, a.HiddenSize = len(net.W1), len(net.W1[0])
+	}
+	if len(net.W2) > 0 {
+		a.OutputSize = len(net.W2[0])
+	}
+	return a
+}
+
+// ParamCount returns the number of trainable parameters (weights and biases).
+func (net *Model[T]) ParamCount() int {
+	count := 0
+	for _, m := range []matrix.Dense[T]{net.W1, net.B1, net.W2, net.B2} {
+		for _, row := range m {
+			count += len(row)
+		}
+	}
+	return count
+}
@@ -0,0 +1,64 @@
+package neural
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	net := NewNetwork(784, 16, 10, 0.1)
+	net.Meta = Metadata{
+		TrainedAt:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Duration:     90 * time.Second,
+		Precision:    "float32",
+		Epochs:       12,
+		BatchSize:    64,
+		LearningRate: 0.3,
+		TrainSamples: 60000,
+		TestAccuracy: 0.9812,
+		TestLoss:     0.061,
+		Preprocess:   "crop,resize=20,pad=28,com",
+		Augment:      "affine=0.5,noise=0.2",
+	}
+
+	var buf bytes.Buffer
+	if err := net.WriteModel(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewNetwork32(784, 16, 10, 0)
+	if err := loaded.ReadModel(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Meta.TrainedAt.Equal(net.Meta.TrainedAt) {
+		t.Errorf("TrainedAt: Expected %v, Got %v", net.Meta.TrainedAt, loaded.Meta.TrainedAt)
+	}
+	loaded.Meta.TrainedAt = net.Meta.TrainedAt
+	if loaded.Meta != net.Meta {
+		t.Errorf("Expected %+v, Got %+v", net.Meta, loaded.Meta)
+	}
+
+	// A model saved without metadata loads with zero metadata
+	buf.Reset()
+	if err := NewNetwork(784, 16, 10, 0.1).WriteModel(&buf); err != nil {
+		t.Fatal(err)
+	}
+	plain := NewNetwork(784, 16, 10, 0)
+	if err := plain.ReadModel(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !plain.Meta.IsZero() {
+		t.Errorf("Expected zero metadata, Got %+v", plain.Meta)
+	}
+}
+
+func TestArchitectureAndParamCount(t *testing.T) {
+	net := NewNetwork(784, 200, 10, 0.1)
+	arch := net.Architecture()
+	if arch.InputSize != 784 || arch.HiddenSize != 200 || arch.OutputSize != 10 {
+		t.Errorf("Expected 784-200-10, Got %+v", arch)
+	}
+	if expected, got := 784*200+200+200*10+10, net.ParamCount(); got != expected {
+		t.Errorf("ParamCount: Expected %d, Got %d", expected, got)
+	}
+}
@@ -3,51 +3,73 @@ package neural
 import (
 	"encoding/gob"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/coolspeed/go-mnist-scratch/matrix"
 )
 
-// Network represents a neural network
-type Network struct {
+// Model represents a neural network whose weights and biases are stored in precision T.
+// The gob encoding is the same for both precisions, so a model saved as one loads as the other.
+type Model[T matrix.Float] struct {
 	// Weights and biases for hidden layer
-	W1 matrix.Matrix
-	B1 matrix.Matrix
+	W1 matrix.Dense[T]
+	B1 matrix.Dense[T]
 	// Weights and biases for output layer
-	W2 matrix.Matrix
-	B2 matrix.Matrix
+	W2 matrix.Dense[T]
+	B2 matrix.Dense[T]
 
 	// Learning rate
 	LearningRate float64
+
+	// How the model was trained, saved together with the weights
+	Meta Metadata
 }
 
-// NewNetwork creates and initializes a new neural network
+// Network represents a neural network computing in float64
+type Network = Model[float64]
+
+// Network32 represents a neural network computing in float32
+type Network32 = Model[float32]
+
+// NewNetwork creates and initializes a new float64 neural network
 func NewNetwork(inputSize, hiddenSize, outputSize int, learningRate float64) *Network {
+	return NewModel[float64](inputSize, hiddenSize, outputSize, learningRate)
+}
+
+// NewNetwork32 creates and initializes a new float32 neural network
+func NewNetwork32(inputSize, hiddenSize, outputSize int, learningRate float64) *Network32 {
+	return NewModel[float32](inputSize, hiddenSize, outputSize, learningRate)
+}
+
+// NewModel creates and initializes a new neural network in precision T
+func NewModel[T matrix.Float](inputSize, hiddenSize, outputSize int, learningRate float64) *Model[T] {
 	rand.Seed(time.Now().UnixNano())
 
-	net := &Network{
+	net := &Model[T]{
 		LearningRate: learningRate,
 	}
 
 	// Initialize weights and biases
 	// W1: inputSize x hiddenSize
-	net.W1 = matrix.NewMatrix(inputSize, hiddenSize)
+	net.W1 = matrix.New[T](inputSize, hiddenSize)
 	// B1: 1 x hiddenSize
-	net.B1 = matrix.NewMatrix(1, hiddenSize)
+	net.B1 = matrix.New[T](1, hiddenSize)
 	// W2: hiddenSize x outputSize
-	net.W2 = matrix.NewMatrix(hiddenSize, outputSize)
+	net.W2 = matrix.New[T](hiddenSize, outputSize)
 	// B2: 1 x outputSize
-	net.B2 = matrix.NewMatrix(1, outputSize)
+	net.B2 = matrix.New[T](1, outputSize)
 
 	// He initialization for weights (suitable for ReLU, often used with others too)
 	// For sigmoid, Xavier might be more appropriate, but given the prompt, this is a reasonable start.
 	stdDev1 := math.Sqrt(2.0 / float64(inputSize))
 	for i := 0; i < inputSize; i++ {
 		for j := 0; j < hiddenSize; j++ {
-			net.W1[i][j] = rand.NormFloat64() * stdDev1
+			net.W1[i][j] = T(rand.NormFloat64() * stdDev1)
 		}
 	}
 	// Biases initialized to zero
@@ -58,7 +80,7 @@ func NewNetwork(inputSize, hiddenSize, outputSize int, learningRate float64) *Ne
 	stdDev2 := math.Sqrt(2.0 / float64(hiddenSize))
 	for i := 0; i < hiddenSize; i++ {
 		for j := 0; j < outputSize; j++ {
-			net.W2[i][j] = rand.NormFloat64() * stdDev2
+			net.W2[i][j] = T(rand.NormFloat64() * stdDev2)
 		}
 	}
 	// Biases initialized to zero
@@ -69,21 +91,22 @@ func NewNetwork(inputSize, hiddenSize, outputSize int, learningRate float64) *Ne
 	return net
 }
 
-// Forward performs the forward pass through the network
+// Forward performs the forward pass through the network.
+// Every row of input is one sample, so a batch of inputs is processed in a single pass.
 // Returns:
 //   - a1: Activated output of the hidden layer
-//   - a2: Activated output of the output layer (Softmax probabilities)
+//   - a2: Activated output of the output layer (Softmax probabilities, one row per sample)
 //   - z1: Weighted sum + bias of hidden layer (before activation)
 //   - z2: Weighted sum + bias of output layer (before activation)
-func (net *Network) Forward(input matrix.Matrix) (a1, a2, z1, z2 matrix.Matrix, err error) {
+func (net *Model[T]) Forward(input matrix.Dense[T]) (a1, a2, z1, z2 matrix.Dense[T], err error) {
 	// Layer 1 (Hidden Layer)
 	z1, err = input.DotProduct(net.W1)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("forward pass error (input.DotProduct(W1)): %w", err)
 	}
-	z1, err = z1.Add(net.B1)
+	z1, err = z1.AddRowVector(net.B1)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("forward pass error (z1.Add(B1)): %w", err)
+		return nil, nil, nil, nil, fmt.Errorf("forward pass error (z1.AddRowVector(B1)): %w", err)
 	}
 	a1 = z1.Apply(Sigmoid) // Apply Sigmoid activation
 
@@ -92,67 +115,73 @@ func (net *Network) Forward(input matrix.Matrix) (a1, a2, z1, z2 matrix.Matrix,
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("forward pass error (a1.DotProduct(W2)): %w", err)
 	}
-	z2, err = z2.Add(net.B2)
+	z2, err = z2.AddRowVector(net.B2)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("forward pass error (z2.Add(B2)): %w", err)
+		return nil, nil, nil, nil, fmt.Errorf("forward pass error (z2.AddRowVector(B2)): %w", err)
 	}
-	// Apply Softmax activation. Softmax operates on a 1D slice of inputs.
-	// Assuming z2 is a 1xN matrix, we need to extract its first row.
+	// Apply Softmax activation. Softmax operates on a 1D slice of inputs,
+	// so it is applied to every row (sample) of z2 separately.
 	if len(z2) == 0 || len(z2[0]) == 0 {
 		return nil, nil, nil, nil, fmt.Errorf("z2 matrix is empty, cannot apply Softmax")
 	}
-	softmaxInputs := z2[0]
-	softmaxOutputs := Softmax(softmaxInputs)
-
-	// Convert softmaxOutputs back to a 1xN matrix
-	a2 = matrix.NewMatrix(1, len(softmaxOutputs))
-	a2[0] = softmaxOutputs
+	a2 = make(matrix.Dense[T], len(z2))
+	for i, row := range z2 {
+		a2[i] = Softmax(row)
+	}
 
 	return a1, a2, z1, z2, nil
 }
 
 // Predict performs a forward pass and returns the predicted digit (0-9)
-func (net *Network) Predict(input matrix.Matrix) (int, error) {
+func (net *Model[T]) Predict(input matrix.Dense[T]) (int, error) {
 	_, a2, _, _, err := net.Forward(input)
 	if err != nil {
 		return -1, fmt.Errorf("prediction error: %w", err)
 	}
 
-	maxVal := -1.0
-	prediction := -1
-
 	// Assuming a2 is a 1xN matrix of probabilities
 	if len(a2) == 0 || len(a2[0]) == 0 {
 		return -1, fmt.Errorf("output layer is empty")
 	}
 
-	for i, val := range a2[0] {
-		if val > maxVal {
-			maxVal = val
-			prediction = i
-		}
-	}
-	return prediction, nil
+	return argmax(a2[0]), nil
 }
 
 
 
 
+// StepStats summarizes a single training step, measured before the weights are updated.
+type StepStats struct {
+	Loss     float64 // Cross-entropy loss of the sample
+	Correct  bool    // Whether the prediction matched the target
+	GradNorm float64 // L2 norm over all weight and bias gradients
+}
+
 // Train trains the neural network using backpropagation
-// This is a placeholder and will need full implementation for backpropagation.
-func (net *Network) Train(input, target matrix.Matrix) error {
+func (net *Model[T]) Train(input, target matrix.Dense[T]) error {
+	_, err := net.TrainStep(input, target)
+	return err
+}
+
+// TrainStep performs one backpropagation update like Train and reports the loss,
+// correctness and gradient norm of the step.
+func (net *Model[T]) TrainStep(input, target matrix.Dense[T]) (StepStats, error) {
+	var stats StepStats
+
 	// Forward pass
 	a1, output, z1, _, err := net.Forward(input)
 	if err != nil {
-		return fmt.Errorf("training forward pass failed: %w", err)
+		return stats, fmt.Errorf("training forward pass failed: %w", err)
 	}
+	stats.Loss = CrossEntropy(output[0], target[0])
+	stats.Correct = argmax(output[0]) == argmax(target[0])
 
 	// Backpropagation
 	// Output Layer Error (delta2)
 	// For Softmax with Cross-Entropy Loss, delta2 = output - target
 	delta2, err := output.Subtract(target)
 	if err != nil {
-		return fmt.Errorf("training output error calculation failed: %w", err)
+		return stats, fmt.Errorf("training output error calculation failed: %w", err)
 	}
 
 	// Update W2 and B2
@@ -160,7 +189,7 @@ func (net *Network) Train(input, target matrix.Matrix) error {
 	a1T := a1.Transpose()
 	dW2, err := a1T.DotProduct(delta2)
 	if err != nil {
-		return fmt.Errorf("training dW2 calculation failed: %w", err)
+		return stats, fmt.Errorf("training dW2 calculation failed: %w", err)
 	}
 	
 	// dB2 is simply sum of delta2 rows, assuming delta2 is 1xN
@@ -173,14 +202,14 @@ func (net *Network) Train(input, target matrix.Matrix) error {
 	w2T := net.W2.Transpose()
 	delta1Intermediate, err := delta2.DotProduct(w2T)
 	if err != nil {
-		return fmt.Errorf("training delta1 intermediate calculation failed: %w", err)
+		return stats, fmt.Errorf("training delta1 intermediate calculation failed: %w", err)
 	}
 	
 z1SigmoidPrime := z1.Apply(SigmoidPrime) // Derivative of sigmoid applied to z1
 	
 	delta1, err := delta1Intermediate.MultiplyElementWise(z1SigmoidPrime) // Custom element-wise multiplication
 	if err != nil {
-		return fmt.Errorf("training delta1 calculation failed: %w", err)
+		return stats, fmt.Errorf("training delta1 calculation failed: %w", err)
 	}
 
 	// Update W1 and B1
@@ -188,71 +217,99 @@ z1SigmoidPrime := z1.Apply(SigmoidPrime) // Derivative of sigmoid applied to z1
 	inputT := input.Transpose()
 	dW1, err := inputT.DotProduct(delta1)
 	if err != nil {
-		return fmt.Errorf("training dW1 calculation failed: %w", err)
+		return stats, fmt.Errorf("training dW1 calculation failed: %w", err)
 	}
 	// dB1 = delta1 (for single sample)
 	dB1 := delta1
 
+	dW1Norm, dB1Norm, dW2Norm, dB2Norm := dW1.Norm(), dB1.Norm(), dW2.Norm(), dB2.Norm()
+	stats.GradNorm = math.Sqrt(dW1Norm*dW1Norm + dB1Norm*dB1Norm + dW2Norm*dW2Norm + dB2Norm*dB2Norm)
+
 	// Apply gradient descent updates
+	lr := T(net.LearningRate)
 	// W2 = W2 - LearningRate * dW2
-	scaled_dW2 := dW2.ScalarMultiply(net.LearningRate) // Implement ScalarMultiply
+	scaled_dW2 := dW2.ScalarMultiply(lr) // Implement ScalarMultiply
 	net.W2, err = net.W2.Subtract(scaled_dW2)
 	if err != nil {
-		return fmt.Errorf("training W2 update failed: %w", err)
+		return stats, fmt.Errorf("training W2 update failed: %w", err)
 	}
 
-	scaled_dB2 := dB2.ScalarMultiply(net.LearningRate)
+	scaled_dB2 := dB2.ScalarMultiply(lr)
 	net.B2, err = net.B2.Subtract(scaled_dB2)
 	if err != nil {
-		return fmt.Errorf("training B2 update failed: %w", err)
+		return stats, fmt.Errorf("training B2 update failed: %w", err)
 	}
 
 	// W1 = W1 - LearningRate * dW1
-	scaled_dW1 := dW1.ScalarMultiply(net.LearningRate)
+	scaled_dW1 := dW1.ScalarMultiply(lr)
 	net.W1, err = net.W1.Subtract(scaled_dW1)
 	if err != nil {
-		return fmt.Errorf("training W1 update failed: %w", err)
+		return stats, fmt.Errorf("training W1 update failed: %w", err)
 	}
 
-	scaled_dB1 := dB1.ScalarMultiply(net.LearningRate)
+	scaled_dB1 := dB1.ScalarMultiply(lr)
 	net.B1, err = net.B1.Subtract(scaled_dB1)
 	if err != nil {
-		return fmt.Errorf("training B1 update failed: %w", err)
+		return stats, fmt.Errorf("training B1 update failed: %w", err)
 	}
 
-	return nil
+	return stats, nil
 }
 
 
 
 
 // SaveModel saves the network's weights and biases to a file using encoding/gob.
-func (net *Network) SaveModel(filename string) error {
-	file, err := os.Create(filename)
+// The model is written to a temporary file that then replaces filename, so readers
+// never see a partially written model.
+func (net *Model[T]) SaveModel(filename string) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer os.Remove(file.Name()) // No-op once the file has been renamed
 
-	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(net)
-	if err != nil {
-		return fmt.Errorf("failed to encode network: %w", err)
+	if err := net.WriteModel(file); err != nil {
+		file.Close()
+		return err
 	}
-
-	return nil
+	// CreateTemp uses mode 0600; keep the permissions os.Create would have given the model file
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
 }
 
 // LoadModel loads the network's weights and biases from a file using encoding/gob.
-func (net *Network) LoadModel(filename string) error {
+func (net *Model[T]) LoadModel(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-	err = decoder.Decode(net)
+	return net.ReadModel(file)
+}
+
+// WriteModel encodes the network's weights and biases to w using encoding/gob.
+func (net *Model[T]) WriteModel(w io.Writer) error {
+	encoder := gob.NewEncoder(w)
+	err := encoder.Encode(net)
+	if err != nil {
+		return fmt.Errorf("failed to encode network: %w", err)
+	}
+
+	return nil
+}
+
+// ReadModel decodes the network's weights and biases from r using encoding/gob.
+func (net *Model[T]) ReadModel(r io.Reader) error {
+	decoder := gob.NewDecoder(r)
+	err := decoder.Decode(net)
 	if err != nil {
 		return fmt.Errorf("failed to decode network: %w", err)
 	}
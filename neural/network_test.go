@@ -0,0 +1,67 @@
+package neural
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+)
+
+func TestModelLoadsAcrossPrecisions(t *testing.T) {
+	dir := t.TempDir()
+
+	// float64 -> float32
+	net64 := NewNetwork(784, 16, 10, 0.1)
+	path64 := filepath.Join(dir, "model64.gob")
+	if err := net64.SaveModel(path64); err != nil {
+		t.Fatalf("SaveModel failed: %v", err)
+	}
+	net32 := NewNetwork32(784, 16, 10, 0.0)
+	if err := net32.LoadModel(path64); err != nil {
+		t.Fatalf("Loading a float64 model as float32 failed: %v", err)
+	}
+	for i := range net64.W1 {
+		for j := range net64.W1[i] {
+			if math.Abs(float64(net32.W1[i][j])-net64.W1[i][j]) > 1e-6 {
+				t.Fatalf("W1[%d][%d]: expected %f, got %f", i, j, net64.W1[i][j], net32.W1[i][j])
+			}
+		}
+	}
+	if net32.LearningRate != net64.LearningRate {
+		t.Errorf("LearningRate: expected %f, got %f", net64.LearningRate, net32.LearningRate)
+	}
+
+	// float32 -> float64
+	path32 := filepath.Join(dir, "model32.gob")
+	if err := net32.SaveModel(path32); err != nil {
+		t.Fatalf("SaveModel failed: %v", err)
+	}
+	reloaded := NewNetwork(784, 16, 10, 0.0)
+	if err := reloaded.LoadModel(path32); err != nil {
+		t.Fatalf("Loading a float32 model as float64 failed: %v", err)
+	}
+	if reloaded.W2[3][4] != float64(net32.W2[3][4]) {
+		t.Errorf("W2[3][4]: expected %f, got %f", net32.W2[3][4], reloaded.W2[3][4])
+	}
+}
+
+func TestTrainFloat32(t *testing.T) {
+	net := NewNetwork32(4, 8, 2, 0.5)
+	input := matrix.Matrix32{{1, 0, 1, 0}}
+	target := matrix.Matrix32{{0, 1}}
+
+	// Repeated steps on a single sample must drive its prediction to the target class
+	for i := 0; i < 50; i++ {
+		if err := net.Train(input, target); err != nil {
+			t.Fatalf("Train returned an unexpected error: %v", err)
+		}
+	}
+	prediction, err := net.Predict(input)
+	if err != nil {
+		t.Fatalf("Predict returned an unexpected error: %v", err)
+	}
+	if prediction != 1 {
+		t.Errorf("Expected prediction 1 after training, got %d", prediction)
+	}
+}
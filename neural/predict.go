@@ -0,0 +1,94 @@
+package neural
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+)
+
+// Prediction is a class label together with its predicted probability.
+type Prediction struct {
+	Label       int     `json:"label"`
+	Probability float64 `json:"probability"`
+}
+
+// PredictProba performs a forward pass and returns the probability of every class for a single input.
+func (net *Model[T]) PredictProba(input matrix.Dense[T]) ([]float64, error) {
+	if len(input) != 1 {
+		return nil, fmt.Errorf("prediction error: expected a single input row, got %d", len(input))
+	}
+	probs, err := net.PredictProbaBatch(input)
+	if err != nil {
+		return nil, err
+	}
+	return probs[0], nil
+}
+
+// PredictTopK returns the k most probable classes for a single input, most probable first.
+// If k exceeds the number of classes, all classes are returned.
+func (net *Model[T]) PredictTopK(input matrix.Dense[T], k int) ([]Prediction, error) {
+	probs, err := net.PredictProba(input)
+	if err != nil {
+		return nil, err
+	}
+	return TopK(probs, k), nil
+}
+
+// PredictProbaBatch performs a single forward pass over all rows of inputs and
+// returns the class probabilities of every row.
+func (net *Model[T]) PredictProbaBatch(inputs matrix.Dense[T]) ([][]float64, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	_, a2, _, _, err := net.Forward(inputs)
+	if err != nil {
+		return nil, fmt.Errorf("prediction error: %w", err)
+	}
+	return matrix.Convert[float64](a2), nil
+}
+
+// PredictBatch performs a single forward pass over all rows of inputs and returns the predicted digit of every row.
+func (net *Model[T]) PredictBatch(inputs matrix.Dense[T]) ([]int, error) {
+	probs, err := net.PredictProbaBatch(inputs)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]int, len(probs))
+	for i, row := range probs {
+		labels[i] = argmax(row)
+	}
+	return labels, nil
+}
+
+// TopK returns the k largest entries of a probability distribution as predictions, most probable first.
+// Ties are ordered by label.
+func TopK(probs []float64, k int) []Prediction {
+	predictions := make([]Prediction, len(probs))
+	for i, p := range probs {
+		predictions[i] = Prediction{Label: i, Probability: p}
+	}
+	sort.SliceStable(predictions, func(a, b int) bool {
+		return predictions[a].Probability > predictions[b].Probability
+	})
+	if k < 0 {
+		k = 0
+	}
+	if k < len(predictions) {
+		predictions = predictions[:k]
+	}
+	return predictions
+}
+
+// Entropy returns the Shannon entropy of a probability distribution in nats.
+// It is 0 for a certain prediction and ln(len(probs)) for a uniform one.
+func Entropy(probs []float64) float64 {
+	h := 0.0
+	for _, p := range probs {
+		if p > 0 {
+			h -= p * math.Log(p)
+		}
+	}
+	return h
+}
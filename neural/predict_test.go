@@ -0,0 +1,121 @@
+package neural
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+)
+
+func TestPredictBatchMatchesPredict(t *testing.T) {
+	net := NewNetwork(784, 32, 10, 0.1)
+
+	r := rand.New(rand.NewSource(1))
+	const samples = 8
+	inputs := matrix.NewMatrix(samples, 784)
+	for s := range inputs {
+		for i := range inputs[s] {
+			if r.Float64() < 0.2 {
+				inputs[s][i] = r.Float64()
+			}
+		}
+	}
+
+	labels, err := net.PredictBatch(inputs)
+	if err != nil {
+		t.Fatalf("PredictBatch returned an unexpected error: %v", err)
+	}
+	batchProbs, err := net.PredictProbaBatch(inputs)
+	if err != nil {
+		t.Fatalf("PredictProbaBatch returned an unexpected error: %v", err)
+	}
+	if len(labels) != samples || len(batchProbs) != samples {
+		t.Fatalf("Expected %d results, got %d labels and %d distributions", samples, len(labels), len(batchProbs))
+	}
+
+	for s := 0; s < samples; s++ {
+		single := matrix.Matrix{inputs[s]}
+		expected, err := net.Predict(single)
+		if err != nil {
+			t.Fatalf("Predict returned an unexpected error: %v", err)
+		}
+		if labels[s] != expected {
+			t.Errorf("Sample %d: batch label %d differs from single prediction %d", s, labels[s], expected)
+		}
+
+		probs, err := net.PredictProba(single)
+		if err != nil {
+			t.Fatalf("PredictProba returned an unexpected error: %v", err)
+		}
+		sum := 0.0
+		for k, p := range probs {
+			sum += p
+			if math.Abs(p-batchProbs[s][k]) > 1e-12 {
+				t.Errorf("Sample %d class %d: batch probability %f differs from %f", s, k, batchProbs[s][k], p)
+			}
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("Sample %d: probabilities sum to %f, expected 1", s, sum)
+		}
+	}
+
+	if _, err := net.PredictProba(inputs); err == nil {
+		t.Error("PredictProba should return an error for more than one input row, but didn't")
+	}
+}
+
+func TestPredictTopK(t *testing.T) {
+	net := NewNetwork(784, 16, 10, 0.1)
+	input := matrix.NewMatrix(1, 784)
+	input[0][300] = 1.0
+
+	top, err := net.PredictTopK(input, 3)
+	if err != nil {
+		t.Fatalf("PredictTopK returned an unexpected error: %v", err)
+	}
+	if len(top) != 3 {
+		t.Fatalf("Expected 3 predictions, got %d", len(top))
+	}
+	expected, _ := net.Predict(input)
+	if top[0].Label != expected {
+		t.Errorf("Top prediction %d differs from Predict %d", top[0].Label, expected)
+	}
+	for i := 1; i < len(top); i++ {
+		if top[i].Probability > top[i-1].Probability {
+			t.Errorf("Predictions are not sorted: %+v", top)
+		}
+	}
+}
+
+func TestTopK(t *testing.T) {
+	probs := []float64{0.1, 0.5, 0.1, 0.3}
+	expected := []Prediction{{Label: 1, Probability: 0.5}, {Label: 3, Probability: 0.3}, {Label: 0, Probability: 0.1}}
+
+	got := TopK(probs, 3)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d predictions, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Prediction %d: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+
+	if n := len(TopK(probs, 10)); n != 4 {
+		t.Errorf("TopK with k larger than the distribution: expected 4 predictions, got %d", n)
+	}
+	if n := len(TopK(probs, 0)); n != 0 {
+		t.Errorf("TopK with k = 0: expected no predictions, got %d", n)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if h := Entropy([]float64{0, 1, 0}); h != 0 {
+		t.Errorf("Entropy of a certain prediction: expected 0, got %f", h)
+	}
+	uniform := []float64{0.25, 0.25, 0.25, 0.25}
+	if h := Entropy(uniform); math.Abs(h-math.Log(4)) > 1e-12 {
+		t.Errorf("Entropy of a uniform distribution: expected %f, got %f", math.Log(4), h)
+	}
+}
@@ -0,0 +1,92 @@
+package neural
+
+import (
+	"fmt"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+)
+
+// QuantizedNetwork is an inference-only copy of a Network.
+// W1 and W2 are stored as per-channel int8, while the biases stay in float64.
+type QuantizedNetwork struct {
+	W1 *matrix.QuantizedMatrix
+	B1 matrix.Matrix
+	W2 *matrix.QuantizedMatrix
+	B2 matrix.Matrix
+}
+
+// Quantize returns a post-training int8 quantized copy of the network.
+func (net *Model[T]) Quantize() *QuantizedNetwork {
+	return &QuantizedNetwork{
+		W1: matrix.Quantize(net.W1),
+		B1: matrix.Convert[float64](net.B1),
+		W2: matrix.Quantize(net.W2),
+		B2: matrix.Convert[float64](net.B2),
+	}
+}
+
+// SizeBytes returns the memory needed for the network's weights and biases.
+func (net *Model[T]) SizeBytes() int {
+	return net.W1.SizeBytes() + net.B1.SizeBytes() + net.W2.SizeBytes() + net.B2.SizeBytes()
+}
+
+// SizeBytes returns the memory needed for the quantized weights, their scales and the biases.
+func (q *QuantizedNetwork) SizeBytes() int {
+	return q.W1.SizeBytes() + q.B1.SizeBytes() + q.W2.SizeBytes() + q.B2.SizeBytes()
+}
+
+// Forward performs the forward pass using int8 weights and returns the Softmax probabilities,
+// one row per input row.
+func (q *QuantizedNetwork) Forward(input matrix.Matrix) (matrix.Matrix, error) {
+	// Layer 1 (Hidden Layer)
+	z1, err := input.QuantizedDotProduct(q.W1)
+	if err != nil {
+		return nil, fmt.Errorf("quantized forward pass error (input.QuantizedDotProduct(W1)): %w", err)
+	}
+	z1, err = z1.AddRowVector(q.B1)
+	if err != nil {
+		return nil, fmt.Errorf("quantized forward pass error (z1.AddRowVector(B1)): %w", err)
+	}
+	a1 := z1.Apply(Sigmoid)
+
+	// Layer 2 (Output Layer)
+	z2, err := a1.QuantizedDotProduct(q.W2)
+	if err != nil {
+		return nil, fmt.Errorf("quantized forward pass error (a1.QuantizedDotProduct(W2)): %w", err)
+	}
+	z2, err = z2.AddRowVector(q.B2)
+	if err != nil {
+		return nil, fmt.Errorf("quantized forward pass error (z2.AddRowVector(B2)): %w", err)
+	}
+	if len(z2) == 0 || len(z2[0]) == 0 {
+		return nil, fmt.Errorf("z2 matrix is empty, cannot apply Softmax")
+	}
+
+	a2 := make(matrix.Matrix, len(z2))
+	for i, row := range z2 {
+		a2[i] = Softmax(row)
+	}
+	return a2, nil
+}
+
+// Predict performs a quantized forward pass and returns the predicted digit (0-9)
+func (q *QuantizedNetwork) Predict(input matrix.Matrix) (int, error) {
+	a2, err := q.Forward(input)
+	if err != nil {
+		return -1, fmt.Errorf("prediction error: %w", err)
+	}
+	return argmax(a2[0]), nil
+}
+
+// argmax returns the index of the largest value, or -1 for an empty slice.
+func argmax[T matrix.Float](values []T) int {
+	maxVal := T(-1.0)
+	prediction := -1
+	for i, val := range values {
+		if val > maxVal {
+			maxVal = val
+			prediction = i
+		}
+	}
+	return prediction
+}
@@ -0,0 +1,49 @@
+package neural
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+)
+
+func TestQuantizedNetworkPredict(t *testing.T) {
+	net := NewNetwork(784, 32, 10, 0.1)
+	q := net.Quantize()
+
+	r := rand.New(rand.NewSource(1))
+	agree := 0
+	const samples = 50
+	for s := 0; s < samples; s++ {
+		input := matrix.NewMatrix(1, 784)
+		for i := range input[0] {
+			if r.Float64() < 0.2 {
+				input[0][i] = r.Float64()
+			}
+		}
+
+		expected, err := net.Predict(input)
+		if err != nil {
+			t.Fatalf("Predict returned an unexpected error: %v", err)
+		}
+		got, err := q.Predict(input)
+		if err != nil {
+			t.Fatalf("Quantized Predict returned an unexpected error: %v", err)
+		}
+		if got < 0 || got > 9 {
+			t.Fatalf("Quantized Predict returned out of range digit %d", got)
+		}
+		if got == expected {
+			agree++
+		}
+	}
+
+	// Quantization noise may flip near-ties, but most predictions must agree
+	if agree < samples*9/10 {
+		t.Errorf("Quantized network agreed with float network on %d/%d samples", agree, samples)
+	}
+
+	if q.SizeBytes() >= net.SizeBytes()/4 {
+		t.Errorf("Quantized size %d bytes should be well under a quarter of %d bytes", q.SizeBytes(), net.SizeBytes())
+	}
+}
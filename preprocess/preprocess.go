@@ -0,0 +1,249 @@
+// Package preprocess turns digit images into network inputs through a pipeline of composable steps.
+// The pipeline a model was trained with is stored in its metadata, so training, validation
+// and serving prepare their inputs in exactly the same way.
+package preprocess
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// MNISTSize is the width and height of an MNIST image.
+	MNISTSize = 28
+	// MNISTDigitSize is the size of the box the digit is scaled into before padding, as in the original MNIST pipeline.
+	MNISTDigitSize = 20
+	// InkThreshold is the intensity above which a pixel counts as ink when looking for the bounding box.
+	InkThreshold = 0.1
+)
+
+// Image is a grayscale image stored row by row with intensities from 0.0 to 1.0.
+// After inversion the digit is bright ink on a dark background, as in MNIST.
+type Image struct {
+	Pixels     []float64
+	Rows, Cols int
+}
+
+// New wraps pixels, rows x cols stored row by row, in an Image.
+func New(pixels []float64, rows, cols int) Image {
+	return Image{Pixels: pixels, Rows: rows, Cols: cols}
+}
+
+// FromImage composites img onto white and returns its luminance normalized to 0.0 (black) - 1.0 (white).
+// Transparent areas count as white paper. Photos and drawings usually need an Invert step afterwards.
+func FromImage(img image.Image) Image {
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(gray, gray.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(gray, gray.Bounds(), img, b.Min, draw.Over)
+
+	rows, cols := b.Dy(), b.Dx()
+	pixels := make([]float64, rows*cols)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			pixels[y*cols+x] = float64(gray.Pix[y*gray.Stride+x]) / 255.0
+		}
+	}
+	return New(pixels, rows, cols)
+}
+
+// at returns the pixel at (x, y), or 0 outside the image.
+func (img Image) at(x, y int) float64 {
+	if x < 0 || y < 0 || x >= img.Cols || y >= img.Rows {
+		return 0
+	}
+	return img.Pixels[y*img.Cols+x]
+}
+
+// Step is a single transformation of a pipeline. Steps never modify their input image.
+type Step interface {
+	Apply(img Image) Image
+	// String returns the step in the form accepted by Parse, such as "resize=20".
+	String() string
+}
+
+// Pipeline applies its steps in order.
+type Pipeline []Step
+
+// Default returns the original MNIST preparation: crop to the ink, scale the digit into a 20x20 box
+// preserving its aspect ratio, pad to 28x28 and move the center of mass to the center.
+func Default() Pipeline {
+	return Pipeline{Crop{}, Resize{Size: MNISTDigitSize}, Pad{Size: MNISTSize}, CenterOfMass{}}
+}
+
+// HasDeskew reports whether p contains a Deskew step.
+func (p Pipeline) HasDeskew() bool {
+	for _, step := range p {
+		if _, ok := step.(Deskew); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WithDeskew returns a copy of p that deskews the image right before its final center-of-mass shift,
+// or at the end if p does not end with one. p is returned unchanged if it already deskews.
+func (p Pipeline) WithDeskew() Pipeline {
+	if p.HasDeskew() {
+		return p
+	}
+	at := len(p)
+	if at > 0 {
+		if _, ok := p[at-1].(CenterOfMass); ok {
+			at--
+		}
+	}
+	out := append(Pipeline{}, p[:at]...)
+	out = append(out, Deskew{})
+	return append(out, p[at:]...)
+}
+
+// WithoutDeskew returns a copy of p without its Deskew steps.
+func (p Pipeline) WithoutDeskew() Pipeline {
+	out := Pipeline{}
+	for _, step := range p {
+		if _, ok := step.(Deskew); !ok {
+			out = append(out, step)
+		}
+	}
+	return out
+}
+
+// Apply runs img through every step of p.
+func (p Pipeline) Apply(img Image) Image {
+	for _, step := range p {
+		img = step.Apply(img)
+	}
+	return img
+}
+
+// ApplyAll runs every image of a dataset, each rows x cols, through p in parallel and returns the
+// resulting pixels. It fails if p does not produce images of the input size, as a model expects.
+func (p Pipeline) ApplyAll(images [][]float64, rows, cols int) ([][]float64, error) {
+	result := make([][]float64, len(images))
+	workers := min(runtime.NumCPU(), max(1, len(images)))
+	chunk := (len(images) + workers - 1) / workers
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start, end := w*chunk, min((w+1)*chunk, len(images))
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				out := p.Apply(New(images[i], rows, cols))
+				if out.Rows != rows || out.Cols != cols {
+					errs[w] = fmt.Errorf("preprocessing %q turns image %d from %dx%d into %dx%d", p, i, cols, rows, out.Cols, out.Rows)
+					return
+				}
+				result[i] = out.Pixels
+			}
+		}(w, start, end)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// String returns the pipeline in the form accepted by Parse, "none" if it has no steps.
+func (p Pipeline) String() string {
+	if len(p) == 0 {
+		return "none"
+	}
+	specs := make([]string, len(p))
+	for i, step := range p {
+		specs[i] = step.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+// Parse reads a comma-separated list of steps such as "invert=auto,crop,resize=20,pad=28,com".
+// "none" or an empty string is the empty pipeline. The steps are:
+//
+//	invert[=auto|always|never]  invert the intensities (default always)
+//	threshold=L                 zero every pixel below intensity L
+//	crop                        crop to the bounding box of the ink
+//	resize=N                    scale the longer side to N pixels, preserving the aspect ratio
+//	pad=N                       center the image on an N x N canvas
+//	com[=bilinear|bicubic]      shift the center of mass to the center of the image by a fraction of a pixel
+//	deskew[=bilinear|bicubic]   remove the slant using the second-order moments
+func Parse(spec string) (Pipeline, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "none" {
+		return Pipeline{}, nil
+	}
+
+	var p Pipeline
+	for _, part := range strings.Split(spec, ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(part), "=")
+		step, err := parseStep(name, value, hasValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preprocessing step %q: %w", part, err)
+		}
+		p = append(p, step)
+	}
+	return p, nil
+}
+
+// parseStep creates the step called name with its optional value.
+func parseStep(name, value string, hasValue bool) (Step, error) {
+	requireSize := func() (int, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("expected a positive size, got %q", value)
+		}
+		return n, nil
+	}
+	noValue := func(step Step) (Step, error) {
+		if hasValue {
+			return nil, fmt.Errorf("%s takes no value", name)
+		}
+		return step, nil
+	}
+
+	switch name {
+	case "invert":
+		if !hasValue {
+			return Invert{Mode: InvertAlways}, nil
+		}
+		mode, err := ParseInvertMode(value)
+		return Invert{Mode: mode}, err
+	case "threshold":
+		level, err := strconv.ParseFloat(value, 64)
+		if err != nil || level < 0 || level > 1 {
+			return nil, fmt.Errorf("expected a level between 0 and 1, got %q", value)
+		}
+		return Threshold{Level: level}, nil
+	case "crop":
+		return noValue(Crop{})
+	case "resize":
+		n, err := requireSize()
+		return Resize{Size: n}, err
+	case "pad":
+		n, err := requireSize()
+		return Pad{Size: n}, err
+	case "com", "deskew":
+		var interp Interpolation
+		if hasValue {
+			var err error
+			if interp, err = ParseInterpolation(value); err != nil {
+				return nil, err
+			}
+		}
+		if name == "com" {
+			return CenterOfMass{Interpolation: interp}, nil
+		}
+		return Deskew{Interpolation: interp}, nil
+	}
+	return nil, fmt.Errorf("unknown step %q", name)
+}
@@ -0,0 +1,115 @@
+package preprocess
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	spec := "invert=auto,threshold=0.25,crop,resize=20,pad=28,com,deskew"
+	p, err := Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 7 {
+		t.Fatalf("Expected 7 steps, Got %d", len(p))
+	}
+	if got := p.String(); got != spec {
+		t.Errorf("Expected the pipeline to format as %q, Got %q", spec, got)
+	}
+
+	if p, err := Parse(" crop , pad=28 "); err != nil || p.String() != "crop,pad=28" {
+		t.Errorf("Expected spaces to be ignored, Got %q, %v", p, err)
+	}
+	if p, err := Parse("com=bicubic,deskew=bilinear"); err != nil || p.String() != "com=bicubic,deskew" {
+		t.Errorf("Expected the interpolation to be kept unless it is the bilinear default, Got %q, %v", p, err)
+	}
+	if p, err := Parse("invert"); err != nil || p.String() != "invert=always" {
+		t.Errorf("Expected invert to default to always, Got %q, %v", p, err)
+	}
+	for _, spec := range []string{"", "none"} {
+		if p, err := Parse(spec); err != nil || len(p) != 0 || p.String() != "none" {
+			t.Errorf("Parse(%q): Expected the empty pipeline, Got %q, %v", spec, p, err)
+		}
+	}
+	if got := Default().String(); got != "crop,resize=20,pad=28,com" {
+		t.Errorf("Unexpected default pipeline %q", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"sharpen", "crop,", "resize", "resize=0", "pad=-1", "pad=x",
+		"threshold", "threshold=2", "invert=sometimes", "com=1", "deskew=nearest", "crop=0.5",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q): Expected an error", spec)
+		}
+	}
+}
+
+func TestFromImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 10, 14, 13))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	img.Set(11, 12, color.Black)
+	img.Set(13, 10, color.Transparent)
+
+	got := FromImage(img)
+	if got.Rows != 3 || got.Cols != 4 {
+		t.Fatalf("Expected a 4x3 image, Got %dx%d", got.Cols, got.Rows)
+	}
+	if got.Pixels[2*4+1] != 0 || got.Pixels[0] != 1 || got.Pixels[3] != 1 {
+		t.Errorf("Expected black ink at (1,2) and white paper elsewhere, Got %v", got.Pixels)
+	}
+}
+
+func TestApplyAll(t *testing.T) {
+	images := make([][]float64, 5)
+	for i := range images {
+		images[i] = make([]float64, 16)
+		images[i][i] = 0.2
+	}
+
+	out, err := Pipeline{Threshold{Level: 0.5}}.ApplyAll(images, 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pixels := range out {
+		if pixels[i] != 0 {
+			t.Errorf("Image %d: Expected the faint pixel to be removed", i)
+		}
+		if images[i][i] != 0.2 {
+			t.Errorf("Image %d: Expected the input to be left unchanged", i)
+		}
+	}
+
+	if _, err := (Pipeline{Pad{Size: 6}}).ApplyAll(images, 4, 4); err == nil {
+		t.Error("Expected an error for a pipeline that changes the image size")
+	}
+}
+
+func TestWithDeskew(t *testing.T) {
+	tests := []struct{ in, with, without string }{
+		{"crop,resize=20,pad=28,com", "crop,resize=20,pad=28,deskew,com", "crop,resize=20,pad=28,com"},
+		{"crop,resize=20,pad=28", "crop,resize=20,pad=28,deskew", "crop,resize=20,pad=28"},
+		{"none", "deskew", "none"},
+		{"deskew=bicubic,com", "deskew=bicubic,com", "com"},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.WithDeskew().String(); got != tt.with {
+			t.Errorf("%q.WithDeskew(): Expected %q, Got %q", tt.in, tt.with, got)
+		}
+		if got := p.WithDeskew().WithoutDeskew().String(); got != tt.without {
+			t.Errorf("%q.WithoutDeskew(): Expected %q, Got %q", tt.in, tt.without, got)
+		}
+		if p.String() != tt.in {
+			t.Errorf("Expected %q to be left unchanged, Got %q", tt.in, p)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package preprocess
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+)
+
+// InvertMode selects whether an image is inverted to get white ink on a black background.
+type InvertMode string
+
+const (
+	InvertAuto   InvertMode = "auto"   // Invert if the border of the image is mostly bright
+	InvertAlways InvertMode = "always" // Always invert (black ink on a white background)
+	InvertNever  InvertMode = "never"  // Never invert (the image already has white ink on black)
+)
+
+// ParseInvertMode converts a string such as "auto" into an InvertMode.
+func ParseInvertMode(s string) (InvertMode, error) {
+	switch mode := InvertMode(s); mode {
+	case InvertAuto, InvertAlways, InvertNever:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown invert mode %q (expected auto, always or never)", s)
+}
+
+// Invert turns dark ink on bright paper into bright ink on a dark background.
+type Invert struct {
+	Mode InvertMode
+}
+
+func (s Invert) Apply(img Image) Image {
+	invert := s.Mode == InvertAlways
+	if s.Mode == InvertAuto {
+		invert = borderMean(img) > 0.5
+	}
+	out := New(make([]float64, len(img.Pixels)), img.Rows, img.Cols)
+	for i, v := range img.Pixels {
+		if invert {
+			v = 1 - v
+		}
+		out.Pixels[i] = v
+	}
+	return out
+}
+
+func (s Invert) String() string { return "invert=" + string(s.Mode) }
+
+// borderMean returns the mean intensity of the outermost pixels, which approximates the background.
+func borderMean(img Image) float64 {
+	if img.Rows == 0 || img.Cols == 0 {
+		return 0
+	}
+	sum, n := 0.0, 0
+	for y := 0; y < img.Rows; y++ {
+		for x := 0; x < img.Cols; x++ {
+			if y == 0 || y == img.Rows-1 || x == 0 || x == img.Cols-1 {
+				sum += img.Pixels[y*img.Cols+x]
+				n++
+			}
+		}
+	}
+	return sum / float64(n)
+}
+
+// Threshold removes faint noise by zeroing every pixel below Level.
+type Threshold struct {
+	Level float64
+}
+
+func (s Threshold) Apply(img Image) Image {
+	out := New(make([]float64, len(img.Pixels)), img.Rows, img.Cols)
+	for i, v := range img.Pixels {
+		if v >= s.Level {
+			out.Pixels[i] = v
+		}
+	}
+	return out
+}
+
+func (s Threshold) String() string { return "threshold=" + strconv.FormatFloat(s.Level, 'g', -1, 64) }
+
+// Crop cuts the image down to the bounding box of the pixels brighter than InkThreshold.
+// An image without ink becomes empty (0x0).
+type Crop struct{}
+
+func (Crop) Apply(img Image) Image {
+	box := inkBounds(img)
+	out := New(make([]float64, box.Dx()*box.Dy()), box.Dy(), box.Dx())
+	for y := 0; y < out.Rows; y++ {
+		copy(out.Pixels[y*out.Cols:(y+1)*out.Cols], img.Pixels[(box.Min.Y+y)*img.Cols+box.Min.X:])
+	}
+	return out
+}
+
+func (Crop) String() string { return "crop" }
+
+// inkBounds returns the smallest rectangle containing all pixels brighter than InkThreshold.
+func inkBounds(img Image) image.Rectangle {
+	box := image.Rectangle{}
+	for y := 0; y < img.Rows; y++ {
+		for x := 0; x < img.Cols; x++ {
+			if img.Pixels[y*img.Cols+x] > InkThreshold {
+				box = box.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return box
+}
+
+// Resize scales the image so its longer side is Size pixels, preserving the aspect ratio.
+// It averages the source area covered by every output pixel, which anti-aliases when shrinking.
+type Resize struct {
+	Size int
+}
+
+func (s Resize) Apply(img Image) Image {
+	if img.Rows == 0 || img.Cols == 0 {
+		return img
+	}
+	scale := float64(s.Size) / float64(max(img.Rows, img.Cols))
+	cols := max(1, int(math.Round(float64(img.Cols)*scale)))
+	rows := max(1, int(math.Round(float64(img.Rows)*scale)))
+	return resizeArea(img, cols, rows)
+}
+
+func (s Resize) String() string { return "resize=" + strconv.Itoa(s.Size) }
+
+// resizeArea resamples img to dstW x dstH by averaging the source area covered by every destination
+// pixel. This anti-aliases when shrinking and interpolates when enlarging.
+func resizeArea(img Image, dstW, dstH int) Image {
+	scaleX := float64(img.Cols) / float64(dstW)
+	scaleY := float64(img.Rows) / float64(dstH)
+	out := New(make([]float64, dstW*dstH), dstH, dstW)
+
+	for dy := 0; dy < dstH; dy++ {
+		y0, y1 := float64(dy)*scaleY, float64(dy+1)*scaleY
+		for dx := 0; dx < dstW; dx++ {
+			x0, x1 := float64(dx)*scaleX, float64(dx+1)*scaleX
+
+			sum := 0.0
+			for sy := int(y0); float64(sy) < y1 && sy < img.Rows; sy++ {
+				wy := math.Min(y1, float64(sy+1)) - math.Max(y0, float64(sy))
+				for sx := int(x0); float64(sx) < x1 && sx < img.Cols; sx++ {
+					wx := math.Min(x1, float64(sx+1)) - math.Max(x0, float64(sx))
+					sum += wx * wy * img.Pixels[sy*img.Cols+sx]
+				}
+			}
+			out.Pixels[dy*dstW+dx] = sum / (scaleX * scaleY)
+		}
+	}
+	return out
+}
+
+// Pad centers the image on a Size x Size black canvas. Larger images are cropped around their center.
+type Pad struct {
+	Size int
+}
+
+func (s Pad) Apply(img Image) Image {
+	out := New(make([]float64, s.Size*s.Size), s.Size, s.Size)
+	offX, offY := (s.Size-img.Cols)/2, (s.Size-img.Rows)/2
+	for y := 0; y < s.Size; y++ {
+		for x := 0; x < s.Size; x++ {
+			out.Pixels[y*s.Size+x] = img.at(x-offX, y-offY)
+		}
+	}
+	return out
+}
+
+func (s Pad) String() string { return "pad=" + strconv.Itoa(s.Size) }
+
+// CenterOfMass shifts the image by a fraction of a pixel so that the intensity-weighted center of its
+// ink lands on the center (Cols/2, Rows/2), which is (14, 14) for MNIST as in the original preparation.
+// The shift is resampled with Interpolation (bilinear if empty). Empty images are unchanged.
+type CenterOfMass struct {
+	Interpolation Interpolation
+}
+
+func (s CenterOfMass) Apply(img Image) Image {
+	cx, cy, total := centroid(img)
+	if total == 0 {
+		return img
+	}
+	shiftX := float64(img.Cols)/2 - cx
+	shiftY := float64(img.Rows)/2 - cy
+	return Warp(img, s.Interpolation, func(x, y float64) (float64, float64) { return x - shiftX, y - shiftY })
+}
+
+func (s CenterOfMass) String() string { return "com" + s.Interpolation.suffix() }
+
+// centroid returns the intensity-weighted center of img and its total intensity.
+func centroid(img Image) (cx, cy, total float64) {
+	for y := 0; y < img.Rows; y++ {
+		for x := 0; x < img.Cols; x++ {
+			v := img.Pixels[y*img.Cols+x]
+			cx += float64(x) * v
+			cy += float64(y) * v
+			total += v
+		}
+	}
+	if total == 0 {
+		return 0, 0, 0
+	}
+	return cx / total, cy / total, total
+}
+
+// Deskew removes the slant of handwriting. It measures the skew as the covariance of x and y
+// over the variance of y (the second-order central moments) and applies the inverse horizontal shear
+// around the center of mass, so a stroke leaning by alpha pixels per row becomes upright.
+// The shear is resampled with Interpolation (bilinear if empty).
+type Deskew struct {
+	Interpolation Interpolation
+}
+
+func (s Deskew) Apply(img Image) Image {
+	cx, cy, total := centroid(img)
+	if total == 0 {
+		return img
+	}
+	varY, covXY := 0.0, 0.0
+	for y := 0; y < img.Rows; y++ {
+		for x := 0; x < img.Cols; x++ {
+			v := img.Pixels[y*img.Cols+x]
+			dx, dy := float64(x)-cx, float64(y)-cy
+			varY += v * dy * dy
+			covXY += v * dx * dy
+		}
+	}
+	if varY < 1e-9 {
+		return img // A single row has no measurable slant
+	}
+	alpha := covXY / varY
+	return Warp(img, s.Interpolation, func(x, y float64) (float64, float64) { return x + alpha*(y-cy), y })
+}
+
+func (s Deskew) String() string { return "deskew" + s.Interpolation.suffix() }
+
+// Interpolation selects how warped images are resampled between pixel centers.
+type Interpolation string
+
+const (
+	// Bilinear weights the 4 nearest pixels. A shift moves the center of mass exactly.
+	Bilinear Interpolation = "bilinear"
+	// Bicubic applies cubic convolution to the 16 nearest pixels, which blurs thin strokes less.
+	// Its overshoot is clipped to 0.0-1.0, so the center of mass may move by a few hundredths of a pixel more.
+	Bicubic Interpolation = "bicubic"
+)
+
+// ParseInterpolation converts "bilinear" or "bicubic" into an Interpolation.
+func ParseInterpolation(s string) (Interpolation, error) {
+	switch i := Interpolation(s); i {
+	case Bilinear, Bicubic:
+		return i, nil
+	}
+	return "", fmt.Errorf("unknown interpolation %q (expected bilinear or bicubic)", s)
+}
+
+// suffix returns the value of a step spec selecting i, empty for the bilinear default.
+func (i Interpolation) suffix() string {
+	if i == "" || i == Bilinear {
+		return ""
+	}
+	return "=" + string(i)
+}
+
+// Warp returns an image of the same size as img whose pixel (x, y) is sampled from img at source(x, y)
+// with the interpolation interp (bilinear if empty). Samples outside img are black.
+func Warp(img Image, interp Interpolation, source func(x, y float64) (float64, float64)) Image {
+	sample := bilinear
+	if interp == Bicubic {
+		sample = bicubic
+	}
+	out := New(make([]float64, len(img.Pixels)), img.Rows, img.Cols)
+	for y := 0; y < img.Rows; y++ {
+		for x := 0; x < img.Cols; x++ {
+			sx, sy := source(float64(x), float64(y))
+			out.Pixels[y*img.Cols+x] = sample(img, sx, sy)
+		}
+	}
+	return out
+}
+
+// bilinear interpolates img at the fractional position (x, y).
+func bilinear(img Image, x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	return (1-fy)*((1-fx)*img.at(ix, iy)+fx*img.at(ix+1, iy)) +
+		fy*((1-fx)*img.at(ix, iy+1)+fx*img.at(ix+1, iy+1))
+}
+
+// bicubic interpolates img at the fractional position (x, y) by cubic convolution, clipped to 0.0-1.0.
+func bicubic(img Image, x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	v := 0.0
+	for j := -1; j <= 2; j++ {
+		wy := cubic(float64(j) - fy)
+		for i := -1; i <= 2; i++ {
+			v += wy * cubic(float64(i)-fx) * img.at(ix+i, iy+j)
+		}
+	}
+	return math.Max(0, math.Min(1, v))
+}
+
+// cubic is the Keys cubic convolution kernel with a = -0.5 (Catmull-Rom), which reproduces
+// linear gradients and is zero at every other pixel center.
+func cubic(t float64) float64 {
+	const a = -0.5
+	t = math.Abs(t)
+	switch {
+	case t <= 1:
+		return ((a+2)*t-(a+3))*t*t + 1
+	case t < 2:
+		return ((a*t-5*a)*t+8*a)*t - 4*a
+	}
+	return 0
+}
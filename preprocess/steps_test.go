@@ -0,0 +1,219 @@
+package preprocess
+
+import (
+	"math"
+	"testing"
+)
+
+// rect returns a rows x cols image with ink of intensity v in the rectangle [x0, x1) x [y0, y1).
+func rect(rows, cols, x0, y0, x1, y1 int, v float64) Image {
+	img := New(make([]float64, rows*cols), rows, cols)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			img.Pixels[y*cols+x] = v
+		}
+	}
+	return img
+}
+
+func sum(img Image) float64 {
+	total := 0.0
+	for _, v := range img.Pixels {
+		total += v
+	}
+	return total
+}
+
+func TestInvert(t *testing.T) {
+	// Dark ink on bright paper
+	paper := rect(5, 5, 0, 0, 5, 5, 1)
+	paper.Pixels[12] = 0
+
+	for _, mode := range []InvertMode{InvertAuto, InvertAlways} {
+		out := Invert{Mode: mode}.Apply(paper)
+		if out.Pixels[12] != 1 || out.Pixels[0] != 0 {
+			t.Errorf("%s: Expected bright ink on black, Got %v", mode, out.Pixels)
+		}
+	}
+	if out := (Invert{Mode: InvertNever}).Apply(paper); out.Pixels[12] != 0 {
+		t.Errorf("never: Expected the image unchanged, Got %v", out.Pixels)
+	}
+	// Already bright ink on black
+	if out := (Invert{Mode: InvertAuto}).Apply(rect(5, 5, 2, 2, 3, 3, 1)); out.Pixels[12] != 1 {
+		t.Errorf("auto: Expected a dark image to stay unchanged, Got %v", out.Pixels)
+	}
+}
+
+func TestCropResizePad(t *testing.T) {
+	// A 40x80 bar scales to 10x20 and is padded to the middle of 28x28
+	img := rect(120, 100, 30, 10, 70, 90, 1)
+	img.Pixels[0] = InkThreshold / 2 // Faint noise outside the ink is cropped away
+
+	cropped := Crop{}.Apply(img)
+	if cropped.Cols != 40 || cropped.Rows != 80 {
+		t.Fatalf("Crop: Expected 40x80, Got %dx%d", cropped.Cols, cropped.Rows)
+	}
+	resized := Resize{Size: 20}.Apply(cropped)
+	if resized.Cols != 10 || resized.Rows != 20 || math.Abs(sum(resized)-200) > 1e-9 {
+		t.Fatalf("Resize: Expected a full 10x20 box, Got %dx%d with total %f", resized.Cols, resized.Rows, sum(resized))
+	}
+	padded := Pad{Size: 28}.Apply(resized)
+	if padded.Cols != 28 || padded.Rows != 28 || sum(padded) != 200 {
+		t.Fatalf("Pad: Expected 28x28 with total 200, Got %dx%d with total %f", padded.Cols, padded.Rows, sum(padded))
+	}
+	if padded.at(9, 4) != 1 || padded.at(18, 23) != 1 || padded.at(8, 4) != 0 || padded.at(19, 23) != 0 {
+		t.Error("Pad: Expected the ink in x 9-18, y 4-23")
+	}
+
+	// An image without ink crops to nothing and pads to an empty canvas
+	empty := Pipeline{Crop{}, Resize{Size: 20}, Pad{Size: 28}}.Apply(rect(10, 10, 0, 0, 0, 0, 0))
+	if empty.Rows != 28 || empty.Cols != 28 || sum(empty) != 0 {
+		t.Errorf("Expected an empty 28x28 image, Got %dx%d with total %f", empty.Cols, empty.Rows, sum(empty))
+	}
+
+	// A larger image is cropped around its center
+	if out := (Pad{Size: 2}).Apply(rect(4, 4, 1, 1, 3, 3, 1)); sum(out) != 4 {
+		t.Errorf("Expected the center 2x2 of a 4x4 image, Got %v", out.Pixels)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	img := New([]float64{0.1, 0.5, 0.9, 0.49}, 2, 2)
+	out := Threshold{Level: 0.5}.Apply(img)
+	want := []float64{0, 0.5, 0.9, 0}
+	for i := range want {
+		if out.Pixels[i] != want[i] {
+			t.Errorf("Pixel %d: Expected %f, Got %f", i, want[i], out.Pixels[i])
+		}
+	}
+}
+
+func TestCenterOfMass(t *testing.T) {
+	// A 3x3 blob centered at (5.5, 20) moves to (14, 14) without losing ink
+	img := rect(28, 28, 4, 19, 7, 22, 1)
+	img.Pixels[19*28+7] = 1.5 // Off-center weight gives a fractional center of mass
+	out := CenterOfMass{}.Apply(img)
+
+	cx, cy, total := centroid(out)
+	if math.Abs(cx-14) > 1e-9 || math.Abs(cy-14) > 1e-9 {
+		t.Errorf("Expected the center of mass at (14, 14), Got (%f, %f)", cx, cy)
+	}
+	if math.Abs(total-sum(img)) > 1e-9 {
+		t.Errorf("Expected the total intensity %f to be preserved, Got %f", sum(img), total)
+	}
+
+	blank := rect(28, 28, 0, 0, 0, 0, 0)
+	if out := (CenterOfMass{}).Apply(blank); sum(out) != 0 {
+		t.Error("Expected an empty image to stay empty")
+	}
+}
+
+func TestDeskew(t *testing.T) {
+	// A stroke leaning right by half a pixel per row, like a slanted "1"
+	img := New(make([]float64, 28*28), 28, 28)
+	for y := 4; y < 24; y++ {
+		x := 14 + float64(y-14)/2
+		img.Pixels[y*28+int(math.Floor(x))] = 1
+	}
+
+	skew := func(img Image) float64 {
+		cx, cy, _ := centroid(img)
+		varY, covXY := 0.0, 0.0
+		for i, v := range img.Pixels {
+			dx, dy := float64(i%img.Cols)-cx, float64(i/img.Cols)-cy
+			varY += v * dy * dy
+			covXY += v * dx * dy
+		}
+		return covXY / varY
+	}
+	if before := skew(img); math.Abs(before-0.5) > 0.05 {
+		t.Fatalf("Expected a skew of about 0.5 before deskewing, Got %f", before)
+	}
+	out := Deskew{}.Apply(img)
+	if after := skew(out); math.Abs(after) > 0.02 {
+		t.Errorf("Expected no skew after deskewing, Got %f", after)
+	}
+	// The stroke stays in the middle column range
+	for y := 6; y < 22; y++ {
+		if out.at(14, y)+out.at(13, y)+out.at(15, y) < 0.9 {
+			t.Errorf("Row %d: Expected the upright stroke near x=14, Got %v", y, out.Pixels[y*28:(y+1)*28])
+			break
+		}
+	}
+}
+
+func TestCenterOfMassSubPixel(t *testing.T) {
+	// Asymmetric strokes with fractional centers of mass anywhere in the image, including
+	// near-integer ones where shifting by a truncated offset is off by almost a pixel
+	shapes := []Image{
+		rect(28, 28, 2, 3, 9, 17, 1),
+		rect(28, 28, 17, 20, 26, 27, 0.6),
+		rect(28, 28, 10, 10, 13, 24, 1),
+	}
+	shapes[0].Pixels[3*28+2] = 0.3
+	shapes[1].Pixels[26*28+25] = 1
+	for y := 10; y < 24; y++ {
+		shapes[2].Pixels[y*28+13] = float64(y-9) / 15 // A stroke fading in on one side
+	}
+
+	for _, interp := range []Interpolation{Bilinear, Bicubic} {
+		for i, img := range shapes {
+			cx, cy, _ := centroid(CenterOfMass{Interpolation: interp}.Apply(img))
+			if math.Hypot(cx-14, cy-14) > 0.1 {
+				t.Errorf("%s, shape %d: Expected the center of mass within 0.1px of (14, 14), Got (%.3f, %.3f)", interp, i, cx, cy)
+			}
+		}
+	}
+
+	// Bicubic keeps a thin stroke sharper than bilinear when the shift falls between pixels
+	line := rect(28, 28, 13, 4, 14, 24, 1)
+	for y := 4; y < 24; y++ {
+		line.Pixels[y*28+14] = 0.2 // Moves the center of mass to x = 13.17
+	}
+	peak := func(img Image) float64 {
+		best := 0.0
+		for _, v := range img.Pixels {
+			best = math.Max(best, v)
+		}
+		return best
+	}
+	bilinearPeak, bicubicPeak := peak(CenterOfMass{}.Apply(line)), peak(CenterOfMass{Interpolation: Bicubic}.Apply(line))
+	if bicubicPeak <= bilinearPeak {
+		t.Errorf("Expected bicubic interpolation to blur less than bilinear: peak %.3f <= %.3f", bicubicPeak, bilinearPeak)
+	}
+}
+
+func TestDefaultPipelineCentersDigits(t *testing.T) {
+	// Whatever the size and position of the digit, the original MNIST preparation scales it into
+	// a 20x20 box and puts its center of mass at (14, 14)
+	for i, img := range []Image{
+		rect(120, 100, 30, 10, 70, 90, 1),
+		rect(50, 300, 200, 5, 290, 45, 1),
+		rect(28, 28, 0, 0, 5, 9, 0.8),
+	} {
+		img.Pixels[len(img.Pixels)/2+3] = 1 // An off-center speck of ink
+		out := Default().Apply(img)
+		if out.Rows != 28 || out.Cols != 28 {
+			t.Fatalf("Image %d: Expected 28x28, Got %dx%d", i, out.Cols, out.Rows)
+		}
+		cx, cy, _ := centroid(out)
+		if math.Hypot(cx-14, cy-14) > 0.1 {
+			t.Errorf("Image %d: Expected the center of mass within 0.1px of (14, 14), Got (%.3f, %.3f)", i, cx, cy)
+		}
+	}
+}
+
+func TestCubicKernel(t *testing.T) {
+	// The kernel interpolates: 1 at the sample itself and 0 at every other pixel center
+	for _, tc := range []struct{ t, want float64 }{{0, 1}, {1, 0}, {-1, 0}, {2, 0}, {2.5, 0}} {
+		if got := cubic(tc.t); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("cubic(%v): Expected %v, Got %v", tc.t, tc.want, got)
+		}
+	}
+	// The weights of the 4 neighbors sum to 1 at every fraction
+	for f := 0.0; f < 1; f += 0.125 {
+		if sum := cubic(-1-f) + cubic(-f) + cubic(1-f) + cubic(2-f); math.Abs(sum-1) > 1e-12 {
+			t.Errorf("Fraction %v: Expected weights summing to 1, Got %v", f, sum)
+		}
+	}
+}
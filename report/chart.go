@@ -0,0 +1,111 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+)
+
+// Chart dimensions in SVG user units
+const (
+	chartWidth   = 480
+	chartHeight  = 280
+	marginLeft   = 56
+	marginRight  = 16
+	marginTop    = 28
+	marginBottom = 40
+	tickCount    = 5
+)
+
+// Series is one line of a line chart.
+type Series struct {
+	Name  string
+	Color string
+	X, Y  []float64
+}
+
+// lineChart renders the series as an inline SVG line chart with axes, ticks and a legend.
+// Series without points are skipped; if no series has points, a placeholder is rendered.
+func lineChart(title, xLabel, yLabel string, series []Series) template.HTML {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" role="img">`, chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="14" font-weight="bold" text-anchor="middle">%s</text>`, chartWidth/2, html.EscapeString(title))
+
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for i := range s.X {
+			minX, maxX = math.Min(minX, s.X[i]), math.Max(maxX, s.X[i])
+			minY, maxY = math.Min(minY, s.Y[i]), math.Max(maxY, s.Y[i])
+		}
+	}
+	if math.IsInf(minX, 1) {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="#888">no data</text></svg>`, chartWidth/2, chartHeight/2)
+		return template.HTML(b.String())
+	}
+	// Avoid a zero-width range for single points or flat lines
+	if maxX == minX {
+		minX, maxX = minX-1, maxX+1
+	}
+	if maxY == minY {
+		pad := math.Max(math.Abs(maxY)*0.1, 1e-3)
+		minY, maxY = minY-pad, maxY+pad
+	}
+
+	plotW := float64(chartWidth - marginLeft - marginRight)
+	plotH := float64(chartHeight - marginTop - marginBottom)
+	px := func(x float64) float64 { return marginLeft + (x-minX)/(maxX-minX)*plotW }
+	py := func(y float64) float64 { return marginTop + (1-(y-minY)/(maxY-minY))*plotH }
+
+	// Grid lines and tick labels
+	for i := 0; i <= tickCount; i++ {
+		f := float64(i) / tickCount
+		y := marginTop + f*plotH
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#eee"/>`, marginLeft, y, chartWidth-marginRight, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" font-size="10" text-anchor="end">%s</text>`, marginLeft-4, y+3, formatTick(maxY-f*(maxY-minY)))
+		x := marginLeft + f*plotW
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" font-size="10" text-anchor="middle">%s</text>`, x, chartHeight-marginBottom+14, formatTick(minX+f*(maxX-minX)))
+	}
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.0f" height="%.0f" fill="none" stroke="#999"/>`, marginLeft, marginTop, plotW, plotH)
+	fmt.Fprintf(&b, `<text x="%.1f" y="%d" font-size="11" text-anchor="middle">%s</text>`, marginLeft+plotW/2, chartHeight-6, html.EscapeString(xLabel))
+	fmt.Fprintf(&b, `<text x="12" y="%.1f" font-size="11" text-anchor="middle" transform="rotate(-90 12 %.1f)">%s</text>`, marginTop+plotH/2, marginTop+plotH/2, html.EscapeString(yLabel))
+
+	// Lines and legend
+	legendY := marginTop + 12
+	for _, s := range series {
+		if len(s.X) == 0 {
+			continue
+		}
+		points := make([]string, len(s.X))
+		for i := range s.X {
+			points[i] = fmt.Sprintf("%.1f,%.1f", px(s.X[i]), py(s.Y[i]))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, s.Color, strings.Join(points, " "))
+		if len(s.X) == 1 {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`, px(s.X[0]), py(s.Y[0]), s.Color)
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, chartWidth-marginRight-110, legendY-9, s.Color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="11">%s</text>`, chartWidth-marginRight-96, legendY, html.EscapeString(s.Name))
+		legendY += 16
+	}
+
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// formatTick formats an axis value compactly.
+func formatTick(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs == 0:
+		return "0"
+	case abs >= 1000 || abs < 0.01:
+		return fmt.Sprintf("%.2g", v)
+	case abs >= 10:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return fmt.Sprintf("%.3g", v)
+	}
+}
@@ -0,0 +1,292 @@
+package report
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/eval"
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/metrics"
+	"github.com/coolspeed/go-mnist-scratch/utils"
+)
+
+// Mistake is a misclassified test sample shown in the report gallery.
+type Mistake struct {
+	Index      int       // Position in the test set
+	Actual     int       // True label
+	Predicted  int       // Predicted label
+	Confidence float64   // Probability assigned to the predicted label
+	Pixels     []float64 // Normalized pixels of the input image
+}
+
+// Data holds everything needed to render a training report.
+type Data struct {
+	Title     string
+	ModelPath string
+	Records   []metrics.Record
+	Confusion *eval.ConfusionMatrix
+	Mistakes  []Mistake     // Rendered in the given order, most confident first is most useful
+	W1        matrix.Matrix // Input x hidden weights; column j is rendered as one tile
+	ImageRows int
+	ImageCols int
+}
+
+// Write renders the report as a single self-contained HTML page.
+// All charts are inline SVG and all images are embedded as PNG data URIs.
+func Write(w io.Writer, d *Data) error {
+	view, err := buildView(d)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(w, view); err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+	return nil
+}
+
+// view is the template input derived from Data.
+type view struct {
+	Title          string
+	ModelPath      string
+	Generated      string
+	Summary        []summaryItem
+	LossChart      template.HTML
+	AccuracyChart  template.HTML
+	LRChart        template.HTML
+	ConfusionRows  []confusionRow
+	ConfusionClass []int
+	Mistakes       []mistakeView
+	WeightTiles    []template.URL
+}
+
+type summaryItem struct {
+	Label, Value string
+}
+
+type confusionRow struct {
+	Actual int
+	Cells  []confusionCell
+}
+
+type confusionCell struct {
+	Count int
+	Style template.CSS
+}
+
+type mistakeView struct {
+	Mistake
+	Image template.URL
+}
+
+func buildView(d *Data) (*view, error) {
+	v := &view{
+		Title:     d.Title,
+		ModelPath: d.ModelPath,
+		Generated: time.Now().Format(time.RFC1123),
+	}
+
+	// Training curves come from epoch records; step records only feed the learning-rate chart
+	var epochs, trainLoss, trainAcc []float64
+	var valEpochs, valLoss, valAcc []float64 // Only epochs with validation
+	var lrX, lrY []float64
+	var last *metrics.Record
+	for i := range d.Records {
+		r := &d.Records[i]
+		lrX = append(lrX, float64(r.Step))
+		lrY = append(lrY, r.LearningRate)
+		if r.Scope != metrics.ScopeEpoch {
+			continue
+		}
+		epochs = append(epochs, float64(r.Epoch))
+		trainLoss = append(trainLoss, r.TrainLoss)
+		trainAcc = append(trainAcc, r.TrainAccuracy*100)
+		if r.ValLoss != nil && r.ValAccuracy != nil {
+			valEpochs = append(valEpochs, float64(r.Epoch))
+			valLoss = append(valLoss, *r.ValLoss)
+			valAcc = append(valAcc, *r.ValAccuracy*100)
+		}
+		last = r
+	}
+	v.LossChart = lineChart("Loss", "epoch", "cross-entropy", []Series{
+		{Name: "train", Color: "#1f77b4", X: epochs, Y: trainLoss},
+		{Name: "validation", Color: "#ff7f0e", X: valEpochs, Y: valLoss},
+	})
+	v.AccuracyChart = lineChart("Accuracy", "epoch", "%", []Series{
+		{Name: "train", Color: "#1f77b4", X: epochs, Y: trainAcc},
+		{Name: "validation", Color: "#ff7f0e", X: valEpochs, Y: valAcc},
+	})
+	v.LRChart = lineChart("Learning Rate", "step", "learning rate", []Series{
+		{Name: "lr", Color: "#2ca02c", X: lrX, Y: lrY},
+	})
+
+	if last != nil {
+		v.Summary = append(v.Summary, summaryItem{"Epochs", fmt.Sprintf("%d", last.Epoch)})
+		if last.ValLoss != nil && last.ValAccuracy != nil {
+			v.Summary = append(v.Summary,
+				summaryItem{"Final validation accuracy", fmt.Sprintf("%.2f%%", *last.ValAccuracy*100)},
+				summaryItem{"Final validation loss", fmt.Sprintf("%.4f", *last.ValLoss)},
+			)
+		}
+		v.Summary = append(v.Summary,
+			summaryItem{"Training time", (time.Duration(last.ElapsedSeconds * float64(time.Second))).Round(time.Second).String()})
+	}
+
+	if d.Confusion != nil {
+		v.Summary = append(v.Summary, summaryItem{"Test accuracy (model)", fmt.Sprintf("%.2f%%", d.Confusion.Accuracy()*100)})
+		maxCount := d.Confusion.Max()
+		for i := 0; i < d.Confusion.NumClasses(); i++ {
+			v.ConfusionClass = append(v.ConfusionClass, i)
+			row := confusionRow{Actual: i}
+			for j, count := range d.Confusion.Counts[i] {
+				row.Cells = append(row.Cells, confusionCell{Count: count, Style: cellStyle(count, maxCount, i == j)})
+			}
+			v.ConfusionRows = append(v.ConfusionRows, row)
+		}
+	}
+
+	for _, m := range d.Mistakes {
+		uri, err := pngDataURI(utils.GrayImage(m.Pixels, d.ImageRows, d.ImageCols))
+		if err != nil {
+			return nil, err
+		}
+		v.Mistakes = append(v.Mistakes, mistakeView{Mistake: m, Image: uri})
+	}
+
+	if len(d.W1) == d.ImageRows*d.ImageCols && len(d.W1) > 0 {
+		for j := range d.W1[0] {
+			uri, err := pngDataURI(weightTile(d.W1, j, d.ImageRows, d.ImageCols))
+			if err != nil {
+				return nil, err
+			}
+			v.WeightTiles = append(v.WeightTiles, uri)
+		}
+	}
+
+	return v, nil
+}
+
+// cellStyle shades a confusion matrix cell: correct predictions in green, errors in red.
+// Errors are scaled against a smaller maximum so rare confusions remain visible.
+func cellStyle(count, maxCount int, diagonal bool) template.CSS {
+	if count == 0 || maxCount == 0 {
+		return ""
+	}
+	alpha := float64(count) / float64(maxCount)
+	if diagonal {
+		return template.CSS(fmt.Sprintf("background: rgba(44,160,44,%.2f)", 0.15+0.85*alpha))
+	}
+	alpha = math.Min(1, alpha*10)
+	return template.CSS(fmt.Sprintf("background: rgba(214,39,40,%.2f)", 0.15+0.85*alpha))
+}
+
+// weightTile renders column col of w as an image using a diverging colormap:
+// positive weights are red, negative weights are blue, scaled by the largest magnitude in the column.
+func weightTile(w matrix.Matrix, col, rows, cols int) *image.RGBA {
+	maxAbs := 0.0
+	for i := range w {
+		maxAbs = math.Max(maxAbs, math.Abs(w[i][col]))
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, cols, rows))
+	for i := range w {
+		v := 0.0
+		if maxAbs > 0 {
+			v = w[i][col] / maxAbs
+		}
+		fade := uint8(255 * (1 - math.Abs(v)))
+		c := color.RGBA{R: 255, G: fade, B: fade, A: 255}
+		if v < 0 {
+			c = color.RGBA{R: fade, G: fade, B: 255, A: 255}
+		}
+		img.Set(i%cols, i/cols, c)
+	}
+	return img
+}
+
+// pngDataURI encodes img as a base64 PNG data URI.
+func pngDataURI(img image.Image) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode png: %w", err)
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.1f%%", v*100) },
+}).Parse(reportHTML))
+
+const reportHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>{{.Title}}</title>
+<style>
+    body { font-family: Arial, sans-serif; margin: 24px auto; max-width: 1040px; color: #222; }
+    h1 { margin-bottom: 4px; }
+    h2 { border-bottom: 1px solid #ddd; padding-bottom: 4px; margin-top: 32px; }
+    .meta { color: #666; font-size: 13px; }
+    .summary td { padding: 2px 12px 2px 0; }
+    .charts { display: flex; flex-wrap: wrap; gap: 16px; }
+    .confusion { border-collapse: collapse; font-size: 13px; }
+    .confusion th, .confusion td { border: 1px solid #ddd; width: 44px; height: 28px; text-align: center; }
+    .gallery { display: flex; flex-wrap: wrap; gap: 8px; }
+    .gallery figure { margin: 0; text-align: center; font-size: 11px; }
+    .pixelated { image-rendering: pixelated; }
+    .digit { width: 84px; height: 84px; background: black; }
+    .tile { width: 56px; height: 56px; border: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="meta">Model: {{.ModelPath}} &middot; Generated {{.Generated}}</div>
+
+{{if .Summary}}
+<h2>Summary</h2>
+<table class="summary">
+{{range .Summary}}<tr><td>{{.Label}}</td><td><b>{{.Value}}</b></td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Training Curves</h2>
+<div class="charts">
+{{.LossChart}}
+{{.AccuracyChart}}
+{{.LRChart}}
+</div>
+
+{{if .ConfusionRows}}
+<h2>Confusion Matrix</h2>
+<p class="meta">Rows are true labels, columns are predicted labels.</p>
+<table class="confusion">
+<tr><th></th>{{range .ConfusionClass}}<th>{{.}}</th>{{end}}</tr>
+{{range .ConfusionRows}}<tr><th>{{.Actual}}</th>{{range .Cells}}<td style="{{.Style}}">{{.Count}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+
+{{if .Mistakes}}
+<h2>Worst Misclassifications</h2>
+<p class="meta">Wrong predictions with the highest confidence.</p>
+<div class="gallery">
+{{range .Mistakes}}<figure><img class="pixelated digit" src="{{.Image}}" alt="test sample {{.Index}}"><figcaption>#{{.Index}}: {{.Actual}} &rarr; {{.Predicted}}<br>{{percent .Confidence}}</figcaption></figure>
+{{end}}</div>
+{{end}}
+
+{{if .WeightTiles}}
+<h2>First Layer Weights (W1)</h2>
+<p class="meta">One tile per hidden unit. Red is positive, blue is negative.</p>
+<div class="gallery">
+{{range $i, $tile := .WeightTiles}}<img class="pixelated tile" src="{{$tile}}" alt="hidden unit {{$i}}" title="hidden unit {{$i}}">
+{{end}}</div>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/eval"
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/metrics"
+)
+
+func TestWrite(t *testing.T) {
+	confusion := eval.NewConfusionMatrix(10)
+	confusion.Add(4, 4)
+	confusion.Add(4, 9)
+
+	w1 := matrix.NewMatrix(4, 3)
+	w1[0][0], w1[1][0] = 1, -1
+
+	d := &Data{
+		Title:     "Test <Report>",
+		ModelPath: "model.gob",
+		Records: []metrics.Record{
+			{Scope: metrics.ScopeStep, Epoch: 1, Step: 10, TrainLoss: 0.9, LearningRate: 0.3},
+			{Scope: metrics.ScopeEpoch, Epoch: 1, Step: 20, TrainLoss: 0.5, ValLoss: metrics.Float(0.4), TrainAccuracy: 0.8, ValAccuracy: metrics.Float(0.85), LearningRate: 0.3},
+			{Scope: metrics.ScopeEpoch, Epoch: 2, Step: 40, TrainLoss: 0.3, ValLoss: metrics.Float(0.35), TrainAccuracy: 0.9, ValAccuracy: metrics.Float(0.9), LearningRate: 0.15},
+		},
+		Confusion: confusion,
+		Mistakes:  []Mistake{{Index: 7, Actual: 4, Predicted: 9, Confidence: 0.973, Pixels: make([]float64, 4)}},
+		W1:        w1,
+		ImageRows: 2,
+		ImageCols: 2,
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, d); err != nil {
+		t.Fatalf("Write returned an unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	checks := []string{
+		"Test &lt;Report&gt;",       // Title is escaped
+		"<svg",                      // Inline charts
+		"Learning Rate",             // LR schedule chart
+		"#7: 4 &rarr; 9<br>97.3%",   // Mistake caption
+		`alt="hidden unit 2"`,       // One weight tile per hidden unit
+		"data:image/png;base64,",    // Embedded images
+		"Final validation accuracy", // Summary from the last epoch record
+	}
+	for _, c := range checks {
+		if !strings.Contains(out, c) {
+			t.Errorf("Report is missing %q", c)
+		}
+	}
+
+	// The report must be self-contained; the SVG namespace is the only allowed URL
+	out = strings.ReplaceAll(out, `xmlns="http://www.w3.org/2000/svg"`, "")
+	for _, external := range []string{"<script src", "<link", "http://", "https://"} {
+		if strings.Contains(out, external) {
+			t.Errorf("Report should not reference external resources, found %q", external)
+		}
+	}
+}
+
+func TestLineChartWithoutData(t *testing.T) {
+	svg := string(lineChart("Empty", "x", "y", []Series{{Name: "none"}}))
+	if !strings.Contains(svg, "no data") {
+		t.Errorf("Chart without points should render a placeholder, got %s", svg)
+	}
+}
@@ -5,6 +5,10 @@ const clearButton = document.getElementById('clearButton');
 const predictionResult = document.getElementById('predictionResult');
 const inferenceTime = document.getElementById('inferenceTime');
 const pixelGridDiv = document.getElementById('pixelGrid'); // We might not update this in real-time anymore
+const confidenceSpan = document.getElementById('confidence');
+const entropySpan = document.getElementById('entropy');
+const lowConfidenceDiv = document.getElementById('lowConfidence');
+const probabilitiesDiv = document.getElementById('probabilities');
 
 const CANVAS_SIZE = 280;
 
@@ -49,8 +53,50 @@ clearButton.addEventListener('click', () => {
     predictionResult.textContent = '_';
     inferenceTime.textContent = '_';
     pixelGridDiv.innerHTML = ''; // Clear debug grid
+    clearProbabilities();
 });
 
+// Render the softmax distribution as one horizontal bar per digit
+function renderProbabilities(data) {
+    probabilitiesDiv.innerHTML = '';
+    data.probabilities.forEach((p, digit) => {
+        const row = document.createElement('div');
+        row.classList.add('prob-row');
+        if (digit === data.prediction) {
+            row.classList.add('top');
+        }
+
+        const label = document.createElement('span');
+        label.classList.add('prob-label');
+        label.textContent = digit;
+
+        const track = document.createElement('div');
+        track.classList.add('prob-track');
+        const bar = document.createElement('div');
+        bar.classList.add('prob-bar');
+        bar.style.width = `${(p * 100).toFixed(1)}%`;
+        track.appendChild(bar);
+
+        const value = document.createElement('span');
+        value.classList.add('prob-value');
+        value.textContent = `${(p * 100).toFixed(1)}%`;
+
+        row.append(label, track, value);
+        probabilitiesDiv.appendChild(row);
+    });
+
+    confidenceSpan.textContent = `${(data.confidence * 100).toFixed(1)}%`;
+    entropySpan.textContent = data.entropy.toFixed(3);
+    lowConfidenceDiv.hidden = !data.low_confidence;
+}
+
+function clearProbabilities() {
+    probabilitiesDiv.innerHTML = '';
+    confidenceSpan.textContent = '_';
+    entropySpan.textContent = '_';
+    lowConfidenceDiv.hidden = true;
+}
+
 // Predict Button
 predictButton.addEventListener('click', async () => {
     // 1. Downsample to 28x28
@@ -119,9 +165,11 @@ predictButton.addEventListener('click', async () => {
         const data = await response.json();
         predictionResult.textContent = data.prediction;
         inferenceTime.textContent = data.duration_us;
+        renderProbabilities(data);
     } catch (error) {
         console.error('Error:', error);
         predictionResult.textContent = 'Err';
         inferenceTime.textContent = '_';
+        clearProbabilities();
     }
 });
\ No newline at end of file
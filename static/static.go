@@ -0,0 +1,204 @@
+// Package static embeds the web UI so the server binary runs from any working directory.
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed index.html script.js
+var files embed.FS
+
+// Files returns the embedded web UI.
+func Files() fs.FS {
+	return files
+}
+
+// minGzipSize is the smallest file worth compressing.
+const minGzipSize = 256
+
+// asset is a file prepared for serving.
+type asset struct {
+	content     []byte
+	gzipped     []byte // Nil if the file does not compress well
+	contentType string
+	etag        string
+	modTime     time.Time
+}
+
+// Handler serves the web UI. index.html is served for "/".
+//
+// Embedded files are prepared once and cached: they cannot change while the server runs.
+// Files in an override directory are read on every request, so edits show up on reload.
+type Handler struct {
+	fsys     fs.FS
+	embedded bool
+
+	mu     sync.Mutex
+	assets map[string]*asset
+}
+
+// NewHandler returns a Handler serving the files in dir, or the embedded files if dir is empty.
+func NewHandler(dir string) *Handler {
+	if dir == "" {
+		return &Handler{fsys: files, embedded: true, assets: make(map[string]*asset)}
+	}
+	return &Handler{fsys: os.DirFS(dir)}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Cleaning the rooted path resolves every ".." inside the root, and fs.FS rejects what is left
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	a, err := h.load(name)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", a.contentType)
+	header.Set("Cache-Control", h.cacheControl(name))
+	header.Set("Vary", "Accept-Encoding")
+	content, etag := a.content, a.etag
+	if a.gzipped != nil && acceptsGzip(r) {
+		header.Set("Content-Encoding", "gzip")
+		// The encoded representation needs its own validator
+		content, etag = a.gzipped, strings.TrimSuffix(etag, `"`)+`-gzip"`
+	}
+	header.Set("ETag", etag)
+	// ServeContent answers conditional and range requests and omits the body for HEAD
+	http.ServeContent(w, r, name, a.modTime, bytes.NewReader(content))
+}
+
+// cacheControl returns the Cache-Control header of a file. Files are not fingerprinted, so
+// index.html and override files are always revalidated (cheap thanks to the ETag), while the
+// embedded scripts may be reused for a while.
+func (h *Handler) cacheControl(name string) string {
+	if !h.embedded || name == "index.html" {
+		return "no-cache"
+	}
+	return "public, max-age=3600"
+}
+
+// load returns the prepared file name, from the cache for embedded files.
+func (h *Handler) load(name string) (*asset, error) {
+	if h.embedded {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if a, ok := h.assets[name]; ok {
+			return a, nil
+		}
+	}
+
+	info, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fs.ErrNotExist
+	}
+	content, err := fs.ReadFile(h.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	a, err := newAsset(name, content, info.ModTime())
+	if err != nil {
+		return nil, err
+	}
+	if h.embedded {
+		h.assets[name] = a
+	}
+	return a, nil
+}
+
+// newAsset detects the content type of a file, computes its ETag and compresses it if worthwhile.
+func newAsset(name string, content []byte, modTime time.Time) (*asset, error) {
+	sum := sha256.Sum256(content)
+	a := &asset{
+		content:     content,
+		contentType: mime.TypeByExtension(path.Ext(name)),
+		etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+		modTime:     modTime,
+	}
+	if a.contentType == "" {
+		a.contentType = http.DetectContentType(content)
+	}
+	if len(content) < minGzipSize || !compressible(a.contentType) {
+		return a, nil
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() < len(content) {
+		a.gzipped = buf.Bytes()
+	}
+	return a, nil
+}
+
+// compressible reports whether a content type is text that gzip shrinks.
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "javascript"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r allows a gzip response.
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "gzip" && coding != "*" {
+				continue
+			}
+			// gzip;q=0 explicitly refuses the encoding
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				weight, err := strconv.ParseFloat(strings.TrimSpace(q), 64)
+				return err == nil && weight > 0
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serve(h http.Handler, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestEmbeddedFiles(t *testing.T) {
+	h := NewHandler("")
+	index, err := fs.ReadFile(Files(), "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := serve(h, "GET", "/", nil)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), index) {
+		t.Fatalf("Expected index.html for /, Got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+	if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+		t.Errorf("Expected an HTML content type, Got %q", got)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Expected index.html to be revalidated, Got Cache-Control %q", got)
+	}
+
+	rr = serve(h, "GET", "/script.js", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get("Content-Type"), "javascript") {
+		t.Errorf("Expected script.js as JavaScript, Got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if got := rr.Header().Get("Cache-Control"); !strings.Contains(got, "max-age") {
+		t.Errorf("Expected script.js to be cacheable, Got Cache-Control %q", got)
+	}
+
+	for _, target := range []string{"/missing.js", "/../static.go", "/%2e%2e/static.go", "/static.go"} {
+		if rr := serve(h, "GET", target, nil); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: Expected %d, Got %d", target, http.StatusNotFound, rr.Code)
+		}
+	}
+	if rr := serve(h, "POST", "/", nil); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: Expected %d, Got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+func TestConditionalRequest(t *testing.T) {
+	h := NewHandler("")
+	etag := serve(h, "GET", "/script.js", nil).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag")
+	}
+	rr := serve(h, "GET", "/script.js", map[string]string{"If-None-Match": etag})
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("Expected %d without a body for a matching ETag, Got %d with %d bytes", http.StatusNotModified, rr.Code, rr.Body.Len())
+	}
+}
+
+func TestGzip(t *testing.T) {
+	h := NewHandler("")
+	plain := serve(h, "GET", "/script.js", nil)
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected no encoding without Accept-Encoding")
+	}
+
+	rr := serve(h, "GET", "/script.js", map[string]string{"Accept-Encoding": "br, gzip;q=0.8"})
+	if rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected a gzip response varying on Accept-Encoding, Got headers %v", rr.Header())
+	}
+	if rr.Header().Get("ETag") == plain.Header().Get("ETag") {
+		t.Error("Expected the gzip response to have its own ETag")
+	}
+	if rr.Body.Len() >= plain.Body.Len() {
+		t.Errorf("Expected the gzip body to be smaller: Got %d >= %d bytes", rr.Body.Len(), plain.Body.Len())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, plain.Body.Bytes()) {
+		t.Error("Expected the decompressed body to match the file")
+	}
+
+	if rr := serve(h, "GET", "/script.js", map[string]string{"Accept-Encoding": "gzip;q=0"}); rr.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected no gzip for gzip;q=0")
+	}
+}
+
+func TestOverrideDir(t *testing.T) {
+	dir := t.TempDir()
+	index := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(index, []byte("<p>v1</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "..", "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(dir)
+
+	rr := serve(h, "GET", "/", nil)
+	if rr.Body.String() != "<p>v1</p>" || rr.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected the override index.html without caching, Got %q (%q)", rr.Body.String(), rr.Header().Get("Cache-Control"))
+	}
+	// Edits show up without a restart
+	if err := os.WriteFile(index, []byte("<p>v2</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if rr := serve(h, "GET", "/", nil); rr.Body.String() != "<p>v2</p>" {
+		t.Errorf("Expected the edited file, Got %q", rr.Body.String())
+	}
+	if rr := serve(h, "GET", "/script.js", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected only the override files to be served, Got %d for script.js", rr.Code)
+	}
+	if rr := serve(h, "GET", "/../secret.txt", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected files outside the directory to be unreachable, Got %d", rr.Code)
+	}
+}
@@ -0,0 +1,235 @@
+package train
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/metrics"
+)
+
+// Callback receives the training state at fixed points of the epoch loop.
+// Returning an error aborts training.
+type Callback[T matrix.Float] interface {
+	OnEpochStart(s *State[T]) error
+	OnBatchEnd(s *State[T]) error
+	OnEpochEnd(s *State[T]) error
+	OnTrainEnd(s *State[T]) error
+}
+
+// Base implements every hook as a no-op. Embed it to implement only the hooks you need.
+type Base[T matrix.Float] struct{}
+
+func (Base[T]) OnEpochStart(*State[T]) error { return nil }
+func (Base[T]) OnBatchEnd(*State[T]) error   { return nil }
+func (Base[T]) OnEpochEnd(*State[T]) error   { return nil }
+func (Base[T]) OnTrainEnd(*State[T]) error   { return nil }
+
+// Funcs adapts plain functions to a Callback. Nil functions are skipped.
+type Funcs[T matrix.Float] struct {
+	EpochStart func(s *State[T]) error
+	BatchEnd   func(s *State[T]) error
+	EpochEnd   func(s *State[T]) error
+	TrainEnd   func(s *State[T]) error
+}
+
+func (f Funcs[T]) OnEpochStart(s *State[T]) error { return callFunc(f.EpochStart, s) }
+func (f Funcs[T]) OnBatchEnd(s *State[T]) error   { return callFunc(f.BatchEnd, s) }
+func (f Funcs[T]) OnEpochEnd(s *State[T]) error   { return callFunc(f.EpochEnd, s) }
+func (f Funcs[T]) OnTrainEnd(s *State[T]) error   { return callFunc(f.TrainEnd, s) }
+
+func callFunc[T matrix.Float](fn func(*State[T]) error, s *State[T]) error {
+	if fn == nil {
+		return nil
+	}
+	return fn(s)
+}
+
+// Progress logs the epoch number and the accuracy of every epoch to Logger (slog.Default() if nil).
+type Progress[T matrix.Float] struct {
+	Base[T]
+	Logger *slog.Logger
+}
+
+func (p Progress[T]) logger() *slog.Logger {
+	if p.Logger == nil {
+		return slog.Default()
+	}
+	return p.Logger
+}
+
+func (p Progress[T]) OnEpochStart(s *State[T]) error {
+	p.logger().Info("epoch started", "epoch", s.Epoch, "epochs", s.Epochs, "learning_rate", s.Net.LearningRate)
+	return nil
+}
+
+func (p Progress[T]) OnEpochEnd(s *State[T]) error {
+	attrs := []any{"epoch", s.Epoch, "train_loss", s.EpochStats.MeanLoss(), "train_accuracy", s.EpochStats.Accuracy() * 100}
+	if s.HasValidation {
+		attrs = append(attrs, "test_loss", s.ValLoss, "test_accuracy", s.ValAccuracy*100)
+	}
+	p.logger().Info("epoch finished", append(attrs, "duration", time.Since(s.EpochStart))...)
+	return nil
+}
+
+// MetricsLogger writes a metrics record after every epoch and, when Every > 0, every Every batches.
+// A step window carries over epoch boundaries, so every step record covers exactly Every batches.
+type MetricsLogger[T matrix.Float] struct {
+	Logger *metrics.Logger
+	Every  int
+
+	window      Stats
+	windowStart time.Time     // Start of the window's training time in the current epoch
+	windowTime  time.Duration // Training time of the window in previous epochs
+}
+
+func (m *MetricsLogger[T]) OnEpochStart(s *State[T]) error {
+	// Validation between epochs does not count towards the throughput of the window
+	m.windowStart = s.EpochStart
+	return nil
+}
+
+func (m *MetricsLogger[T]) OnBatchEnd(s *State[T]) error {
+	m.window.Samples += s.BatchStats.Samples
+	m.window.Loss += s.BatchStats.Loss
+	m.window.Correct += s.BatchStats.Correct
+	m.window.GradNorm += s.BatchStats.GradNorm
+
+	if m.Every <= 0 || s.Step%m.Every != 0 {
+		return nil
+	}
+	record := m.record(metrics.ScopeStep, s, &m.window, m.windowTime+time.Since(m.windowStart))
+	m.window = Stats{}
+	m.windowStart = time.Now()
+	m.windowTime = 0
+	return m.Logger.Log(record)
+}
+
+func (m *MetricsLogger[T]) OnEpochEnd(s *State[T]) error {
+	m.windowTime += time.Since(m.windowStart)
+	record := m.record(metrics.ScopeEpoch, s, &s.EpochStats, time.Since(s.EpochStart))
+	if s.HasValidation {
+		record.ValLoss, record.ValAccuracy = metrics.Float(s.ValLoss), metrics.Float(s.ValAccuracy)
+	}
+	return m.Logger.Log(record)
+}
+
+func (m *MetricsLogger[T]) OnTrainEnd(*State[T]) error { return nil }
+
+// record converts accumulated statistics and the current model state into a metrics record.
+// duration is the wall time covered by stats and is used for the throughput.
+func (m *MetricsLogger[T]) record(scope string, s *State[T], stats *Stats, duration time.Duration) metrics.Record {
+	r := metrics.Record{
+		Scope:          scope,
+		Epoch:          s.Epoch,
+		Step:           s.Step,
+		TrainLoss:      stats.MeanLoss(),
+		TrainAccuracy:  stats.Accuracy(),
+		LearningRate:   s.Net.LearningRate,
+		GradNorm:       stats.MeanGradNorm(),
+		W1Norm:         s.Net.W1.Norm(),
+		W2Norm:         s.Net.W2.Norm(),
+		ElapsedSeconds: time.Since(s.StartTime).Seconds(),
+	}
+	if duration > 0 {
+		r.SamplesPerSec = float64(stats.Samples) / duration.Seconds()
+	}
+	return r
+}
+
+// Checkpoint saves the model to Path at the end of every epoch.
+// With BestOnly, the model is saved only when the validation accuracy improves.
+type Checkpoint[T matrix.Float] struct {
+	Base[T]
+	Path     string
+	BestOnly bool
+
+	best  float64
+	saved bool
+}
+
+func (c *Checkpoint[T]) OnEpochEnd(s *State[T]) error {
+	if c.BestOnly {
+		if !s.HasValidation || (c.saved && s.ValAccuracy <= c.best) {
+			return nil
+		}
+		c.best = s.ValAccuracy
+	}
+	if err := s.Net.SaveModel(c.Path); err != nil {
+		return fmt.Errorf("checkpoint failed: %w", err)
+	}
+	c.saved = true
+	return nil
+}
+
+// EarlyStopping stops training when the validation loss has not improved by at least MinDelta
+// for Patience consecutive epochs. It has no effect without validation data.
+type EarlyStopping[T matrix.Float] struct {
+	Base[T]
+	Patience int
+	MinDelta float64
+
+	// BestEpoch and BestLoss describe the epoch with the lowest validation loss so far
+	BestEpoch int
+	BestLoss  float64
+
+	wait int
+}
+
+func (e *EarlyStopping[T]) OnEpochEnd(s *State[T]) error {
+	if !s.HasValidation {
+		return nil
+	}
+	if e.BestEpoch == 0 || s.ValLoss < e.BestLoss-e.MinDelta {
+		e.BestEpoch, e.BestLoss = s.Epoch, s.ValLoss
+		e.wait = 0
+		return nil
+	}
+	e.wait++
+	if e.wait >= e.Patience {
+		slog.Info("early stopping", "epoch", s.Epoch, "best_epoch", e.BestEpoch, "best_loss", e.BestLoss)
+		s.Stop = true
+	}
+	return nil
+}
+
+// Schedule returns the learning rate for a 1-based epoch, given the initial learning rate.
+type Schedule func(base float64, epoch int) float64
+
+// StepDecay multiplies the learning rate by gamma every `every` epochs.
+func StepDecay(every int, gamma float64) Schedule {
+	return func(base float64, epoch int) float64 {
+		if every <= 0 {
+			return base
+		}
+		return base * math.Pow(gamma, float64((epoch-1)/every))
+	}
+}
+
+// ExponentialDecay multiplies the learning rate by gamma every epoch.
+func ExponentialDecay(gamma float64) Schedule {
+	return func(base float64, epoch int) float64 {
+		return base * math.Pow(gamma, float64(epoch-1))
+	}
+}
+
+// LRScheduler sets the network's learning rate at the start of every epoch.
+// The learning rate at the first epoch is used as the base.
+type LRScheduler[T matrix.Float] struct {
+	Base[T]
+	Schedule Schedule
+
+	base    float64
+	started bool
+}
+
+func (l *LRScheduler[T]) OnEpochStart(s *State[T]) error {
+	if !l.started {
+		l.base = s.Net.LearningRate
+		l.started = true
+	}
+	s.Net.LearningRate = l.Schedule(l.base, s.Epoch)
+	return nil
+}
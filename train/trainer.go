@@ -0,0 +1,221 @@
+package train
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/coolspeed/go-mnist-scratch/dataset"
+	"github.com/coolspeed/go-mnist-scratch/matrix"
+	"github.com/coolspeed/go-mnist-scratch/neural"
+)
+
+// Trainer runs the epoch loop for a network and calls its callbacks at fixed points.
+type Trainer[T matrix.Float] struct {
+	Net *neural.Model[T]
+
+	// Training data, read in a new random order every epoch. Wrap it with dataset.Transform to
+	// augment the images; the transform runs on the prefetch goroutine while the network trains.
+	TrainData dataset.Dataset
+
+	// Optional validation data, evaluated after every epoch
+	ValData dataset.Dataset
+
+	NumClasses int
+	Epochs     int
+	BatchSize  int
+	// DropLast skips the last batch of an epoch if it is incomplete
+	DropLast bool
+
+	// Callbacks are called in order at every hook
+	Callbacks []Callback[T]
+
+	// Rand shuffles the training data each epoch. A time-seeded source is used if nil.
+	Rand *rand.Rand
+}
+
+const (
+	// prefetchBatches is the number of training batches prepared ahead while the network trains.
+	prefetchBatches = 2
+	// evalBatchSize is the number of samples Evaluate passes through the network at once.
+	evalBatchSize = 256
+)
+
+// Stats accumulates per-sample training statistics.
+type Stats struct {
+	Samples  int
+	Loss     float64 // Sum of per-sample losses
+	Correct  int
+	GradNorm float64 // Sum of per-sample gradient norms
+}
+
+// Add accumulates one training step.
+func (s *Stats) Add(step neural.StepStats) {
+	s.Samples++
+	s.Loss += step.Loss
+	s.GradNorm += step.GradNorm
+	if step.Correct {
+		s.Correct++
+	}
+}
+
+// MeanLoss returns the average loss, or 0 if nothing was accumulated.
+func (s *Stats) MeanLoss() float64 {
+	if s.Samples == 0 {
+		return 0
+	}
+	return s.Loss / float64(s.Samples)
+}
+
+// Accuracy returns the fraction of correct predictions, or 0 if nothing was accumulated.
+func (s *Stats) Accuracy() float64 {
+	if s.Samples == 0 {
+		return 0
+	}
+	return float64(s.Correct) / float64(s.Samples)
+}
+
+// MeanGradNorm returns the average gradient norm, or 0 if nothing was accumulated.
+func (s *Stats) MeanGradNorm() float64 {
+	if s.Samples == 0 {
+		return 0
+	}
+	return s.GradNorm / float64(s.Samples)
+}
+
+// State is shared with the callbacks. Callbacks may change Net.LearningRate or set Stop.
+type State[T matrix.Float] struct {
+	Net    *neural.Model[T]
+	Epoch  int // 1-based index of the current epoch
+	Epochs int
+	Step   int // Number of batches processed since the start of training
+
+	BatchStats Stats // Statistics of the batch that just finished
+	EpochStats Stats // Statistics of the current epoch so far
+
+	// Validation results of the current epoch, set before OnEpochEnd when validation data is present
+	HasValidation bool
+	ValLoss       float64
+	ValAccuracy   float64
+
+	StartTime  time.Time // Start of training
+	EpochStart time.Time // Start of the current epoch
+
+	// Stop ends training after the current epoch when set by a callback
+	Stop bool
+}
+
+// Run trains the network for the configured number of epochs, or until a callback sets Stop.
+// A callback error aborts training and is returned.
+func (t *Trainer[T]) Run() error {
+	if t.TrainData == nil {
+		return fmt.Errorf("no training data")
+	}
+	if t.BatchSize <= 0 {
+		return fmt.Errorf("batch size must be positive, got %d", t.BatchSize)
+	}
+	r := t.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	loader := &dataset.DataLoader{
+		Dataset:    t.TrainData,
+		BatchSize:  t.BatchSize,
+		NumClasses: t.NumClasses,
+		Shuffle:    true,
+		Rand:       r,
+		DropLast:   t.DropLast,
+		Prefetch:   prefetchBatches,
+	}
+
+	s := &State[T]{Net: t.Net, Epochs: t.Epochs, StartTime: time.Now()}
+
+	for e := 1; e <= t.Epochs && !s.Stop; e++ {
+		s.Epoch = e
+		s.EpochStats = Stats{}
+		s.HasValidation = false
+		s.EpochStart = time.Now()
+		if err := t.call(s, Callback[T].OnEpochStart); err != nil {
+			return err
+		}
+
+		for batch := range loader.Batches() {
+			inputs := matrix.Convert[T](batch.Inputs)
+			targets := matrix.Convert[T](batch.Targets)
+
+			// The network trains one sample at a time; a batch groups samples for the callbacks.
+			s.BatchStats = Stats{}
+			for j := range inputs {
+				step, err := t.Net.TrainStep(inputs[j:j+1], targets[j:j+1])
+				if err != nil {
+					return fmt.Errorf("training on sample %d failed: %w", batch.Indices[j], err)
+				}
+				s.BatchStats.Add(step)
+				s.EpochStats.Add(step)
+			}
+			s.Step++
+
+			if err := t.call(s, Callback[T].OnBatchEnd); err != nil {
+				return err
+			}
+		}
+
+		if t.ValData != nil && t.ValData.Len() > 0 {
+			loss, accuracy, err := Evaluate(t.Net, t.ValData, t.NumClasses)
+			if err != nil {
+				return err
+			}
+			s.HasValidation = true
+			s.ValLoss, s.ValAccuracy = loss, accuracy
+		}
+
+		if err := t.call(s, Callback[T].OnEpochEnd); err != nil {
+			return err
+		}
+	}
+
+	return t.call(s, Callback[T].OnTrainEnd)
+}
+
+// call invokes hook on every callback in order and stops at the first error.
+func (t *Trainer[T]) call(s *State[T], hook func(Callback[T], *State[T]) error) error {
+	for _, cb := range t.Callbacks {
+		if err := hook(cb, s); err != nil {
+			return fmt.Errorf("callback failed at epoch %d: %w", s.Epoch, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the mean cross-entropy loss and the accuracy (0-1) of net on data.
+// Samples are passed through the network in batches.
+func Evaluate[T matrix.Float](net *neural.Model[T], data dataset.Dataset, numClasses int) (float64, float64, error) {
+	if data.Len() == 0 {
+		return 0, 0, nil
+	}
+
+	loss := 0.0
+	correct := 0
+	loader := &dataset.DataLoader{Dataset: data, BatchSize: evalBatchSize, NumClasses: numClasses}
+	for batch := range loader.Batches() {
+		_, probs, _, _, err := net.Forward(matrix.Convert[T](batch.Inputs))
+		if err != nil {
+			return 0, 0, fmt.Errorf("evaluating samples %d-%d failed: %w", batch.Indices[0], batch.Indices[batch.Len()-1], err)
+		}
+		targets := matrix.Convert[T](batch.Targets)
+		for j, row := range probs {
+			loss += neural.CrossEntropy(row, targets[j])
+
+			predicted := 0
+			for k, p := range row {
+				if p > row[predicted] {
+					predicted = k
+				}
+			}
+			if predicted == int(batch.Labels[j]) {
+				correct++
+			}
+		}
+	}
+	return loss / float64(data.Len()), float64(correct) / float64(data.Len()), nil
+}
@@ -0,0 +1,227 @@
+package train
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coolspeed/go-mnist-scratch/dataset"
+	"github.com/coolspeed/go-mnist-scratch/metrics"
+	"github.com/coolspeed/go-mnist-scratch/neural"
+)
+
+// toyData returns a linearly separable 2-class problem on 4 inputs.
+func toyData(n int) dataset.Dataset {
+	r := rand.New(rand.NewSource(1))
+	images := make([][]float64, n)
+	labels := make([]uint8, n)
+	for i := range images {
+		label := uint8(i % 2)
+		img := make([]float64, 4)
+		for j := range img {
+			img[j] = 0.1 * r.Float64()
+		}
+		img[label*2] += 0.9
+		images[i] = img
+		labels[i] = label
+	}
+	data, _ := dataset.FromSlices(images, labels)
+	return data
+}
+
+func newToyTrainer(epochs int, callbacks ...Callback[float64]) *Trainer[float64] {
+	data := toyData(40)
+	return &Trainer[float64]{
+		Net:        neural.NewNetwork(4, 6, 2, 0.5),
+		TrainData:  data,
+		ValData:    data,
+		NumClasses: 2,
+		Epochs:     epochs,
+		BatchSize:  16,
+		Callbacks:  callbacks,
+		Rand:       rand.New(rand.NewSource(2)),
+	}
+}
+
+func TestTrainerHooks(t *testing.T) {
+	var calls []string
+	cb := Funcs[float64]{
+		EpochStart: func(s *State[float64]) error { calls = append(calls, "start"); return nil },
+		BatchEnd:   func(s *State[float64]) error { calls = append(calls, "batch"); return nil },
+		EpochEnd: func(s *State[float64]) error {
+			if !s.HasValidation {
+				t.Error("Validation results should be set before OnEpochEnd")
+			}
+			calls = append(calls, "end")
+			return nil
+		},
+		TrainEnd: func(s *State[float64]) error { calls = append(calls, "train"); return nil },
+	}
+
+	tr := newToyTrainer(2, cb)
+	if err := tr.Run(); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+
+	// 40 samples in batches of 16 gives 3 batches per epoch
+	expected := "start batch batch batch end start batch batch batch end train"
+	if got := strings.Join(calls, " "); got != expected {
+		t.Errorf("Hook order mismatch.\nExpected: %s\nGot: %s", expected, got)
+	}
+
+	_, accuracy, err := Evaluate(tr.Net, tr.ValData, 2)
+	if err != nil {
+		t.Fatalf("Evaluate returned an unexpected error: %v", err)
+	}
+	if accuracy < 0.9 {
+		t.Errorf("Expected the toy problem to be learned, accuracy %.2f", accuracy)
+	}
+}
+
+func TestTrainerAugment(t *testing.T) {
+	tr := newToyTrainer(3)
+	original := tr.TrainData.Get(0).Pixels[0]
+	var calls atomic.Int64
+	tr.TrainData = dataset.Transform(tr.TrainData, func(pixels []float64) []float64 {
+		calls.Add(1)
+		out := append([]float64(nil), pixels...)
+		out[0] += 0.01
+		return out
+	})
+	if err := tr.Run(); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	if expected := 3 * tr.TrainData.Len(); calls.Load() != int64(expected) {
+		t.Errorf("Expected every sample to be augmented once per epoch (%d calls), Got %d", expected, calls.Load())
+	}
+	if tr.ValData.Get(0).Pixels[0] != original {
+		t.Error("Expected the training images to be left unchanged")
+	}
+}
+
+func TestTrainerDropLast(t *testing.T) {
+	var batches, samples int
+	counter := Funcs[float64]{
+		BatchEnd: func(s *State[float64]) error { batches++; return nil },
+		EpochEnd: func(s *State[float64]) error { samples = s.EpochStats.Samples; return nil },
+	}
+	tr := newToyTrainer(1, counter)
+	tr.DropLast = true
+	if err := tr.Run(); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	// 40 samples in batches of 16 leaves an incomplete batch of 8
+	if batches != 2 || samples != 32 {
+		t.Errorf("Expected 2 batches of 32 samples, Got %d batches of %d samples", batches, samples)
+	}
+}
+
+func TestEarlyStopping(t *testing.T) {
+	epochs := 0
+	counter := Funcs[float64]{EpochEnd: func(*State[float64]) error { epochs++; return nil }}
+	// An infinite MinDelta can never be beaten, so training stops after Patience epochs without improvement
+	stopper := &EarlyStopping[float64]{Patience: 2, MinDelta: math.Inf(1)}
+
+	if err := newToyTrainer(10, counter, stopper).Run(); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	if epochs != 3 {
+		t.Errorf("Expected training to stop after 3 epochs, ran %d", epochs)
+	}
+	if stopper.BestEpoch != 1 {
+		t.Errorf("Expected best epoch 1, got %d", stopper.BestEpoch)
+	}
+}
+
+func TestLRScheduler(t *testing.T) {
+	var rates []float64
+	recorder := Funcs[float64]{EpochStart: func(s *State[float64]) error {
+		rates = append(rates, s.Net.LearningRate)
+		return nil
+	}}
+
+	scheduler := &LRScheduler[float64]{Schedule: StepDecay(2, 0.5)}
+	if err := newToyTrainer(5, scheduler, recorder).Run(); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+
+	expected := []float64{0.5, 0.5, 0.25, 0.25, 0.125}
+	for i, want := range expected {
+		if math.Abs(rates[i]-want) > 1e-12 {
+			t.Errorf("Epoch %d learning rate: expected %f, got %f", i+1, want, rates[i])
+		}
+	}
+
+	if got := ExponentialDecay(0.9)(1.0, 3); math.Abs(got-0.81) > 1e-12 {
+		t.Errorf("ExponentialDecay epoch 3: expected 0.81, got %f", got)
+	}
+}
+
+func TestCheckpointAndMetricsLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "best.gob")
+	var buf bytes.Buffer
+	logger := metrics.NewLogger(&buf, metrics.JSONL)
+
+	tr := newToyTrainer(2, &Checkpoint[float64]{Path: path, BestOnly: true}, &MetricsLogger[float64]{Logger: logger, Every: 2})
+	if err := tr.Run(); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Checkpoint file was not written: %v", err)
+	}
+
+	records, err := metrics.Read(&buf, metrics.JSONL)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	// Steps 2, 4 and 6 produce step records, plus one epoch record per epoch
+	var steps, epochs int
+	for _, r := range records {
+		switch r.Scope {
+		case metrics.ScopeStep:
+			steps++
+		case metrics.ScopeEpoch:
+			epochs++
+			if r.ValAccuracy == nil || r.W1Norm == 0 || r.SamplesPerSec == 0 {
+				t.Errorf("Epoch record is missing fields: %+v", r)
+			}
+		}
+	}
+	if steps != 3 || epochs != 2 {
+		t.Errorf("Expected 3 step and 2 epoch records, got %d and %d", steps, epochs)
+	}
+}
+
+func TestMetricsLoggerWindowAcrossEpochs(t *testing.T) {
+	var buf bytes.Buffer
+	var batches []Stats
+	collect := Funcs[float64]{BatchEnd: func(s *State[float64]) error { batches = append(batches, s.BatchStats); return nil }}
+
+	// 3 batches per epoch, so the window of step 4 spans the last batch of epoch 1 and the first of epoch 2
+	tr := newToyTrainer(2, collect, &MetricsLogger[float64]{Logger: metrics.NewLogger(&buf, metrics.JSONL), Every: 2})
+	if err := tr.Run(); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	records, err := metrics.Read(&buf, metrics.JSONL)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	for _, r := range records {
+		if r.Scope != metrics.ScopeStep || r.Step != 4 {
+			continue
+		}
+		a, b := batches[2], batches[3]
+		want := (a.Loss + b.Loss) / float64(a.Samples+b.Samples)
+		if math.Abs(r.TrainLoss-want) > 1e-9 {
+			t.Errorf("Expected the step 4 record to cover batches 3 and 4 (loss %f), Got %f", want, r.TrainLoss)
+		}
+		return
+	}
+	t.Error("Expected a step record at step 4")
+}
@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// IDXType is the data type code stored in the third byte of an IDX magic number.
+type IDXType byte
+
+const (
+	IDXUByte  IDXType = 0x08 // unsigned byte
+	IDXByte   IDXType = 0x09 // signed byte
+	IDXShort  IDXType = 0x0B // 16-bit integer
+	IDXInt    IDXType = 0x0C // 32-bit integer
+	IDXFloat  IDXType = 0x0D // 32-bit float
+	IDXDouble IDXType = 0x0E // 64-bit float
+)
+
+// Size returns the number of bytes of one element, or 0 for an unknown type.
+func (t IDXType) Size() int {
+	switch t {
+	case IDXUByte, IDXByte:
+		return 1
+	case IDXShort:
+		return 2
+	case IDXInt, IDXFloat:
+		return 4
+	case IDXDouble:
+		return 8
+	}
+	return 0
+}
+
+func (t IDXType) String() string {
+	switch t {
+	case IDXUByte:
+		return "ubyte"
+	case IDXByte:
+		return "byte"
+	case IDXShort:
+		return "short"
+	case IDXInt:
+		return "int"
+	case IDXFloat:
+		return "float"
+	case IDXDouble:
+		return "double"
+	}
+	return fmt.Sprintf("unknown(0x%02x)", byte(t))
+}
+
+// IDX is an n-dimensional array in the IDX format used by MNIST. The elements are kept as the
+// raw big-endian bytes of the file, in row-major order; Value and Float64s decode them.
+type IDX struct {
+	Type IDXType
+	Dims []int
+	Data []byte
+}
+
+// NewIDX encodes values, row-major with the shape dims, as an IDX array of type t.
+// Integer types require integral values within their range.
+func NewIDX(t IDXType, dims []int, values []float64) (*IDX, error) {
+	size := t.Size()
+	if size == 0 {
+		return nil, fmt.Errorf("unknown IDX type %s", t)
+	}
+	n, err := idxLen(dims)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(values) {
+		return nil, fmt.Errorf("IDX shape %v holds %d elements, got %d values", dims, n, len(values))
+	}
+
+	x := &IDX{Type: t, Dims: append([]int(nil), dims...), Data: make([]byte, n*size)}
+	if r, ok := idxIntRange[t]; ok {
+		for i, v := range values {
+			if v != math.Trunc(v) || v < r[0] || v > r[1] {
+				return nil, fmt.Errorf("value %v at index %d does not fit IDX type %s", v, i, t)
+			}
+		}
+	}
+
+	for i, v := range values {
+		b := x.Data[i*size:]
+		switch t {
+		case IDXUByte, IDXByte:
+			b[0] = byte(int64(v))
+		case IDXShort:
+			binary.BigEndian.PutUint16(b, uint16(int16(v)))
+		case IDXInt:
+			binary.BigEndian.PutUint32(b, uint32(int32(v)))
+		case IDXFloat:
+			binary.BigEndian.PutUint32(b, math.Float32bits(float32(v)))
+		case IDXDouble:
+			binary.BigEndian.PutUint64(b, math.Float64bits(v))
+		}
+	}
+	return x, nil
+}
+
+// idxIntRange holds the smallest and largest value of every integer IDX type.
+var idxIntRange = map[IDXType][2]float64{
+	IDXUByte: {0, math.MaxUint8},
+	IDXByte:  {math.MinInt8, math.MaxInt8},
+	IDXShort: {math.MinInt16, math.MaxInt16},
+	IDXInt:   {math.MinInt32, math.MaxInt32},
+}
+
+// idxLen returns the number of elements of an array with the shape dims.
+func idxLen(dims []int) (int, error) {
+	if len(dims) > math.MaxUint8 {
+		return 0, fmt.Errorf("IDX arrays have at most 255 dimensions, got %d", len(dims))
+	}
+	n := 1
+	for _, d := range dims {
+		if d < 0 || d > math.MaxUint32 {
+			return 0, fmt.Errorf("invalid IDX dimension %d", d)
+		}
+		if d > 0 && n > math.MaxInt/d {
+			return 0, fmt.Errorf("IDX shape %v is too large", dims)
+		}
+		n *= d
+	}
+	return n, nil
+}
+
+// Magic returns the magic number of x: two zero bytes, the type and the number of dimensions.
+func (x *IDX) Magic() uint32 {
+	return uint32(x.Type)<<8 | uint32(len(x.Dims))
+}
+
+// Len returns the number of elements of x.
+func (x *IDX) Len() int {
+	return len(x.Data) / x.Type.Size()
+}
+
+// Value decodes element i of x.
+func (x *IDX) Value(i int) float64 {
+	b := x.Data[i*x.Type.Size():]
+	switch x.Type {
+	case IDXUByte:
+		return float64(b[0])
+	case IDXByte:
+		return float64(int8(b[0]))
+	case IDXShort:
+		return float64(int16(binary.BigEndian.Uint16(b)))
+	case IDXInt:
+		return float64(int32(binary.BigEndian.Uint32(b)))
+	case IDXFloat:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case IDXDouble:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// Float64s decodes every element of x. All IDX types convert to float64 exactly.
+func (x *IDX) Float64s() []float64 {
+	values := make([]float64, x.Len())
+	for i := range values {
+		values[i] = x.Value(i)
+	}
+	return values
+}
+
+// ReadIDX reads an IDX array from r, which may be gzip-compressed. It validates the magic number
+// and fails if the data is shorter than the dimensions declare.
+func ReadIDX(r io.Reader) (*IDX, error) {
+	br := bufio.NewReader(r)
+	if head, err := br.Peek(2); err == nil && head[0] == 0x1f && head[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, fmt.Errorf("failed to read magic number: %w", err)
+	}
+	t := IDXType(magic[2])
+	if magic[0] != 0 || magic[1] != 0 || t.Size() == 0 {
+		return nil, fmt.Errorf("invalid IDX magic number 0x%08x", binary.BigEndian.Uint32(magic[:]))
+	}
+
+	dims := make([]int, magic[3])
+	for i := range dims {
+		var d uint32
+		if err := binary.Read(br, binary.BigEndian, &d); err != nil {
+			return nil, fmt.Errorf("failed to read dimension %d: %w", i, err)
+		}
+		dims[i] = int(d)
+	}
+	n, err := idxLen(dims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read through a limited reader so a corrupt header cannot allocate more than the input holds
+	want := int64(n) * int64(t.Size())
+	data, err := io.ReadAll(io.LimitReader(br, want))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	if int64(len(data)) != want {
+		return nil, fmt.Errorf("IDX data truncated: shape %v of %s needs %d bytes, got %d", dims, t, want, len(data))
+	}
+	return &IDX{Type: t, Dims: dims, Data: data}, nil
+}
+
+// WriteIDX writes x to w in the IDX format, uncompressed.
+func WriteIDX(w io.Writer, x *IDX) error {
+	n, err := idxLen(x.Dims)
+	if err != nil {
+		return err
+	}
+	if x.Type.Size() == 0 {
+		return fmt.Errorf("unknown IDX type %s", x.Type)
+	}
+	if n*x.Type.Size() != len(x.Data) {
+		return fmt.Errorf("IDX shape %v of %s needs %d bytes, got %d", x.Dims, x.Type, n*x.Type.Size(), len(x.Data))
+	}
+
+	header := make([]uint32, 1+len(x.Dims))
+	header[0] = x.Magic()
+	for i, d := range x.Dims {
+		header[i+1] = uint32(d)
+	}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return fmt.Errorf("failed to write IDX header: %w", err)
+	}
+	if _, err := w.Write(x.Data); err != nil {
+		return fmt.Errorf("failed to write IDX data: %w", err)
+	}
+	return nil
+}
+
+// LoadIDX reads an IDX file, gzip-compressed or not.
+func LoadIDX(filePath string) (*IDX, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IDX file: %w", err)
+	}
+	defer file.Close()
+
+	x, err := ReadIDX(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return x, nil
+}
+
+// SaveIDX writes x to an IDX file, gzip-compressed if the path ends in ".gz".
+func SaveIDX(filePath string, x *IDX) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create IDX file: %w", err)
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	var gz *gzip.Writer
+	if strings.HasSuffix(filePath, ".gz") {
+		gz = gzip.NewWriter(file)
+		w = gz
+	}
+	bw := bufio.NewWriter(w)
+	if err := WriteIDX(bw, x); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write IDX file: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to write IDX file: %w", err)
+		}
+	}
+	return file.Close()
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIDXRoundTrip(t *testing.T) {
+	tests := []struct {
+		typ    IDXType
+		dims   []int
+		values []float64
+	}{
+		{IDXUByte, []int{2, 3}, []float64{0, 1, 127, 128, 254, 255}},
+		{IDXByte, []int{4}, []float64{-128, -1, 0, 127}},
+		{IDXShort, []int{1, 2, 2}, []float64{-32768, -2, 300, 32767}},
+		{IDXInt, []int{3}, []float64{-2147483648, 65536, 2147483647}},
+		{IDXFloat, []int{2, 1, 1, 2}, []float64{-1.5, 0, 0.25, 1 << 100}},
+		{IDXDouble, []int{2}, []float64{-1e300, 0.1}},
+		{IDXUByte, []int{}, []float64{7}}, // Rank 0 holds a single element
+	}
+	for _, tt := range tests {
+		x, err := NewIDX(tt.typ, tt.dims, tt.values)
+		if err != nil {
+			t.Fatalf("%s: NewIDX returned an unexpected error: %v", tt.typ, err)
+		}
+		var plain bytes.Buffer
+		if err := WriteIDX(&plain, x); err != nil {
+			t.Fatalf("%s: WriteIDX returned an unexpected error: %v", tt.typ, err)
+		}
+		if got, want := plain.Len(), 4+4*len(tt.dims)+len(tt.values)*tt.typ.Size(); got != want {
+			t.Errorf("%s: Expected %d bytes, Got %d", tt.typ, want, got)
+		}
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(plain.Bytes())
+		gz.Close()
+
+		for name, data := range map[string][]byte{"plain": plain.Bytes(), "gzip": compressed.Bytes()} {
+			got, err := ReadIDX(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s %s: ReadIDX returned an unexpected error: %v", tt.typ, name, err)
+			}
+			if got.Type != tt.typ || len(got.Dims) != len(tt.dims) || got.Magic() != x.Magic() {
+				t.Errorf("%s %s: Expected type %s with shape %v, Got %s with shape %v", tt.typ, name, tt.typ, tt.dims, got.Type, got.Dims)
+			}
+			for i, v := range got.Float64s() {
+				if v != tt.values[i] {
+					t.Errorf("%s %s: Expected value %v at index %d, Got %v", tt.typ, name, tt.values[i], i, v)
+				}
+			}
+		}
+	}
+}
+
+func TestNewIDXErrors(t *testing.T) {
+	tests := []struct {
+		typ    IDXType
+		dims   []int
+		values []float64
+	}{
+		{IDXUByte, []int{2}, []float64{256, 0}},
+		{IDXUByte, []int{1}, []float64{-1}},
+		{IDXByte, []int{1}, []float64{128}},
+		{IDXShort, []int{1}, []float64{0.5}},
+		{IDXInt, []int{1}, []float64{1 << 31}},
+		{IDXFloat, []int{3}, []float64{1, 2}},
+		{IDXType(0x0A), []int{1}, []float64{1}},
+		{IDXDouble, []int{-1}, nil},
+	}
+	for _, tt := range tests {
+		if _, err := NewIDX(tt.typ, tt.dims, tt.values); err == nil {
+			t.Errorf("NewIDX(%s, %v, %v): Expected an error", tt.typ, tt.dims, tt.values)
+		}
+	}
+}
+
+func TestReadIDXErrors(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":          {},
+		"short magic":    {0, 0, 8},
+		"nonzero prefix": {1, 0, 8, 1, 0, 0, 0, 1, 5},
+		"unknown type":   {0, 0, 0x0A, 1, 0, 0, 0, 1, 5},
+		"missing dims":   {0, 0, 8, 2, 0, 0, 0, 1},
+		"truncated data": {0, 0, 0x0C, 1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0},
+		"huge shape":     {0, 0, 8, 2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, data := range tests {
+		if _, err := ReadIDX(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: Expected an error", name)
+		}
+	}
+}
+
+func TestSaveAndLoadMNIST(t *testing.T) {
+	dir := t.TempDir()
+	images := &ImageData{NumImages: 2, NumRows: 2, NumCols: 3, Images: [][]float64{
+		{0, 0.5, 1, 1.2, -0.1, 1.0 / 255},
+		{0.25, 0, 0, 0, 0, 0.75},
+	}}
+	labels := &LabelData{NumLabels: 2, Labels: []uint8{7, 3}}
+
+	for _, ext := range []string{"", ".gz"} {
+		imagePath := filepath.Join(dir, "images-idx3-ubyte"+ext)
+		labelPath := filepath.Join(dir, "labels-idx1-ubyte"+ext)
+		if err := SaveImages(imagePath, images); err != nil {
+			t.Fatalf("SaveImages returned an unexpected error: %v", err)
+		}
+		if err := SaveLabels(labelPath, labels); err != nil {
+			t.Fatalf("SaveLabels returned an unexpected error: %v", err)
+		}
+		raw, _ := os.ReadFile(imagePath)
+		if gzipped := len(raw) > 1 && raw[0] == 0x1f && raw[1] == 0x8b; gzipped != (ext == ".gz") {
+			t.Errorf("%q: Expected gzip compression only for .gz paths", imagePath)
+		}
+
+		gotImages, gotLabels, err := LoadMNIST(imagePath, labelPath)
+		if err != nil {
+			t.Fatalf("LoadMNIST returned an unexpected error: %v", err)
+		}
+		if gotImages.MagicNumber != 0x803 || gotLabels.MagicNumber != 0x801 {
+			t.Errorf("Expected magic numbers 0x803 and 0x801, Got 0x%x and 0x%x", gotImages.MagicNumber, gotLabels.MagicNumber)
+		}
+		if gotImages.NumImages != 2 || gotImages.NumRows != 2 || gotImages.NumCols != 3 {
+			t.Errorf("Expected 2 images of 3x2, Got %d of %dx%d", gotImages.NumImages, gotImages.NumCols, gotImages.NumRows)
+		}
+		// Pixels are quantized to 1/255 and clipped to 0.0-1.0
+		want := []float64{0, 128.0 / 255, 1, 1, 0, 1.0 / 255}
+		for i, v := range gotImages.Images[0] {
+			if v != want[i] {
+				t.Errorf("Pixel %d: Expected %v, Got %v", i, want[i], v)
+			}
+		}
+		if gotLabels.NumLabels != 2 || gotLabels.Labels[0] != 7 || gotLabels.Labels[1] != 3 {
+			t.Errorf("Expected labels [7 3], Got %v", gotLabels.Labels)
+		}
+	}
+}
+
+func TestLoadImagesFloat(t *testing.T) {
+	// Float images are loaded as they are, without the 0-255 normalization
+	path := filepath.Join(t.TempDir(), "images-idx3-float")
+	x, err := NewIDX(IDXFloat, []int{1, 1, 2}, []float64{0.5, 0.125})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveIDX(path, x); err != nil {
+		t.Fatal(err)
+	}
+	images, err := LoadImages(path)
+	if err != nil {
+		t.Fatalf("LoadImages returned an unexpected error: %v", err)
+	}
+	if images.Images[0][0] != 0.5 || images.Images[0][1] != 0.125 {
+		t.Errorf("Expected [0.5 0.125], Got %v", images.Images[0])
+	}
+
+	// Rank and label checks
+	if _, err := LoadLabels(path); err == nil {
+		t.Error("Expected an error loading a rank 3 file as labels")
+	}
+	labelPath := filepath.Join(t.TempDir(), "labels-idx1-short")
+	x, _ = NewIDX(IDXShort, []int{2}, []float64{3, 300})
+	if err := SaveIDX(labelPath, x); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLabels(labelPath); err == nil {
+		t.Error("Expected an error for a label that does not fit in a byte")
+	}
+	if _, err := LoadImages(labelPath); err == nil {
+		t.Error("Expected an error loading a rank 1 file as images")
+	}
+}
+
+func TestLoadIDXTestSet(t *testing.T) {
+	path := filepath.Join("..", "data", "t10k-images-idx3-ubyte.gz")
+	if _, err := os.Stat(path); err != nil {
+		t.Skip("MNIST test images not downloaded")
+	}
+	x, err := LoadIDX(path)
+	if err != nil {
+		t.Fatalf("LoadIDX returned an unexpected error: %v", err)
+	}
+	if x.Magic() != 0x803 || x.Type != IDXUByte || len(x.Dims) != 3 || x.Dims[0] != expectedTestImages || x.Dims[1] != 28 || x.Dims[2] != 28 {
+		t.Errorf("Expected 10000x28x28 unsigned bytes, Got %s with shape %v", x.Type, x.Dims)
+	}
+}
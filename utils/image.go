@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+)
+
+// GrayImage converts normalized pixels (0.0 = background, 1.0 = ink) into a grayscale image.
+// Values outside [0, 1] are clamped.
+func GrayImage(pixels []float64, rows, cols int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, cols, rows))
+	for i, val := range pixels {
+		if i >= rows*cols {
+			break
+		}
+		if val < 0 {
+			val = 0
+		} else if val > 1 {
+			val = 1
+		}
+		img.SetGray(i%cols, i/cols, color.Gray{Y: uint8(val*255 + 0.5)})
+	}
+	return img
+}
+
+// Image returns image i of the dataset as a grayscale image with white ink on a black background.
+func (d *ImageData) Image(i int) *image.Gray {
+	return GrayImage(d.Images[i], int(d.NumRows), int(d.NumCols))
+}
+
+// ContactSheet tiles grayscale images into a single image with cols tiles per row,
+// separated by padding pixels of mid-gray. All tiles are assumed to have the size of the first image.
+func ContactSheet(images []*image.Gray, cols, padding int) *image.Gray {
+	if len(images) == 0 || cols <= 0 {
+		return image.NewGray(image.Rect(0, 0, 0, 0))
+	}
+	if cols > len(images) {
+		cols = len(images)
+	}
+	rows := (len(images) + cols - 1) / cols
+	tileW := images[0].Bounds().Dx()
+	tileH := images[0].Bounds().Dy()
+
+	sheet := image.NewGray(image.Rect(0, 0, cols*(tileW+padding)+padding, rows*(tileH+padding)+padding))
+	draw.Draw(sheet, sheet.Bounds(), &image.Uniform{C: color.Gray{Y: 128}}, image.Point{}, draw.Src)
+	for i, img := range images {
+		x := padding + (i%cols)*(tileW+padding)
+		y := padding + (i/cols)*(tileH+padding)
+		draw.Draw(sheet, image.Rect(x, y, x+tileW, y+tileH), img, img.Bounds().Min, draw.Src)
+	}
+	return sheet
+}
+
+// SavePNG encodes img as a PNG file at path.
+func SavePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create png file: %w", err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		return fmt.Errorf("failed to encode png: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrayImage(t *testing.T) {
+	pixels := []float64{0.0, 1.0, 0.5, -0.2, 1.7, 0.0}
+	img := GrayImage(pixels, 2, 3)
+
+	if b := img.Bounds(); b.Dx() != 3 || b.Dy() != 2 {
+		t.Fatalf("Expected 3x2 image, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	expected := [][]uint8{{0, 255, 128}, {0, 255, 0}}
+	for y := range expected {
+		for x, want := range expected[y] {
+			if got := img.GrayAt(x, y).Y; got != want {
+				t.Errorf("Pixel (%d, %d): expected %d, got %d", x, y, want, got)
+			}
+		}
+	}
+
+	data := &ImageData{NumImages: 1, NumRows: 2, NumCols: 3, Images: [][]float64{pixels}}
+	if got := data.Image(0).GrayAt(1, 0).Y; got != 255 {
+		t.Errorf("ImageData.Image pixel (1, 0): expected 255, got %d", got)
+	}
+}
+
+func TestContactSheet(t *testing.T) {
+	tiles := make([]*image.Gray, 5)
+	for i := range tiles {
+		pixels := make([]float64, 4)
+		pixels[0] = 1.0
+		tiles[i] = GrayImage(pixels, 2, 2)
+	}
+
+	// 5 tiles of 2x2 in 3 columns with 1px padding: 3*(2+1)+1 = 10 wide, 2*(2+1)+1 = 7 high
+	sheet := ContactSheet(tiles, 3, 1)
+	if b := sheet.Bounds(); b.Dx() != 10 || b.Dy() != 7 {
+		t.Fatalf("Expected 10x7 contact sheet, got %dx%d", b.Dx(), b.Dy())
+	}
+	if got := sheet.GrayAt(0, 0).Y; got != 128 {
+		t.Errorf("Padding pixel: expected 128, got %d", got)
+	}
+	// Top-left pixel of the fifth tile (row 1, column 1)
+	if got := sheet.GrayAt(4, 4).Y; got != 255 {
+		t.Errorf("Tile pixel: expected 255, got %d", got)
+	}
+	// The unused sixth slot stays padding
+	if got := sheet.GrayAt(7, 4).Y; got != 128 {
+		t.Errorf("Empty slot pixel: expected 128, got %d", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "sheet.png")
+	if err := SavePNG(path, sheet); err != nil {
+		t.Fatalf("SavePNG returned an unexpected error: %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	decoded, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("Saved file is not a valid PNG: %v", err)
+	}
+	if decoded.Bounds() != sheet.Bounds() {
+		t.Errorf("Decoded bounds %v differ from %v", decoded.Bounds(), sheet.Bounds())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"os"
 )
 
@@ -24,96 +25,97 @@ type LabelData struct {
 	Labels      []uint8 // Raw labels
 }
 
-// LoadImages reads MNIST image data from a gzipped IDX file.
+// LoadImages reads MNIST image data from an IDX file of rank 3 (images x rows x columns), gzipped or not.
+// Unsigned byte pixels are normalized from 0-255 to 0.0-1.0; pixels of the other types are taken as they are.
 func LoadImages(filePath string) (*ImageData, error) {
-	file, err := os.Open(filePath)
+	x, err := LoadIDX(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open image file: %w", err)
+		return nil, fmt.Errorf("failed to load image file: %w", err)
 	}
-	defer file.Close()
-
-	gz, err := gzip.NewReader(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gzip reader for image file: %w", err)
-	}
-	defer gz.Close()
-
-	var magicNumber uint32
-	if err := binary.Read(gz, binary.BigEndian, &magicNumber); err != nil {
-		return nil, fmt.Errorf("failed to read magic number from image file: %w", err)
+	if len(x.Dims) != 3 {
+		return nil, fmt.Errorf("%s: expected 3 image dimensions, got shape %v", filePath, x.Dims)
 	}
 
-	var numImages, numRows, numCols uint32
-	if err := binary.Read(gz, binary.BigEndian, &numImages); err != nil {
-		return nil, fmt.Errorf("failed to read number of images: %w", err)
-	}
-	if err := binary.Read(gz, binary.BigEndian, &numRows); err != nil {
-		return nil, fmt.Errorf("failed to read number of rows: %w", err)
+	numImages, numRows, numCols := x.Dims[0], x.Dims[1], x.Dims[2]
+	totalPixels := numRows * numCols
+	scale := 1.0
+	if x.Type == IDXUByte {
+		scale = 1 / 255.0 // Normalize to 0.0-1.0
 	}
-	if err := binary.Read(gz, binary.BigEndian, &numCols); err != nil {
-		return nil, fmt.Errorf("failed to read number of columns: %w", err)
-	}
-
-	totalPixels := int(numRows * numCols)
 	images := make([][]float64, numImages)
-	pixelBuffer := make([]byte, totalPixels)
-
-	for i := uint32(0); i < numImages; i++ {
-		_, err := io.ReadFull(gz, pixelBuffer)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read pixels for image %d: %w", i, err)
-		}
-
+	for i := range images {
 		images[i] = make([]float64, totalPixels)
-		for j, pixel := range pixelBuffer {
-			images[i][j] = float64(pixel) / 255.0 // Normalize to 0.0-1.0
+		for j := range images[i] {
+			images[i][j] = x.Value(i*totalPixels+j) * scale
 		}
 	}
 
 	return &ImageData{
-		MagicNumber: magicNumber,
-		NumImages:   numImages,
-		NumRows:     numRows,
-		NumCols:     numCols,
+		MagicNumber: x.Magic(),
+		NumImages:   uint32(numImages),
+		NumRows:     uint32(numRows),
+		NumCols:     uint32(numCols),
 		Images:      images,
 	}, nil
 }
 
-// LoadLabels reads MNIST label data from a gzipped IDX file.
+// LoadLabels reads MNIST label data from an IDX file of rank 1, gzipped or not.
+// Labels of any integer type are accepted as long as they fit in a byte.
 func LoadLabels(filePath string) (*LabelData, error) {
-	file, err := os.Open(filePath)
+	x, err := LoadIDX(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open label file: %w", err)
+		return nil, fmt.Errorf("failed to load label file: %w", err)
 	}
-	defer file.Close()
-
-	gz, err := gzip.NewReader(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gzip reader for label file: %w", err)
+	if len(x.Dims) != 1 {
+		return nil, fmt.Errorf("%s: expected 1 label dimension, got shape %v", filePath, x.Dims)
 	}
-	defer gz.Close()
 
-	var magicNumber uint32
-	if err := binary.Read(gz, binary.BigEndian, &magicNumber); err != nil {
-		return nil, fmt.Errorf("failed to read magic number from label file: %w", err)
+	labels := make([]uint8, x.Dims[0])
+	for i := range labels {
+		v := x.Value(i)
+		if v != math.Trunc(v) || v < 0 || v > math.MaxUint8 {
+			return nil, fmt.Errorf("%s: invalid label %v at index %d", filePath, v, i)
+		}
+		labels[i] = uint8(v)
 	}
 
-	var numLabels uint32
-	if err := binary.Read(gz, binary.BigEndian, &numLabels); err != nil {
-		return nil, fmt.Errorf("failed to read number of labels: %w", err)
+	return &LabelData{
+		MagicNumber: x.Magic(),
+		NumLabels:   uint32(len(labels)),
+		Labels:      labels,
+	}, nil
+}
+
+// IDX encodes the images as an unsigned byte IDX array, scaling 0.0-1.0 to 0-255 and clipping.
+func (d *ImageData) IDX() (*IDX, error) {
+	rows, cols := int(d.NumRows), int(d.NumCols)
+	values := make([]float64, 0, len(d.Images)*rows*cols)
+	for i, img := range d.Images {
+		if len(img) != rows*cols {
+			return nil, fmt.Errorf("image %d has %d pixels, expected %dx%d", i, len(img), cols, rows)
+		}
+		for _, v := range img {
+			values = append(values, math.Round(math.Max(0, math.Min(1, v))*255))
+		}
 	}
+	return NewIDX(IDXUByte, []int{len(d.Images), rows, cols}, values)
+}
 
-	labels := make([]uint8, numLabels)
-	_, err = io.ReadFull(gz, labels)
+// SaveImages writes the images to an unsigned byte IDX file that LoadImages reads back,
+// gzip-compressed if the path ends in ".gz".
+func SaveImages(filePath string, d *ImageData) error {
+	x, err := d.IDX()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read labels: %w", err)
+		return fmt.Errorf("failed to encode images: %w", err)
 	}
+	return SaveIDX(filePath, x)
+}
 
-	return &LabelData{
-		MagicNumber: magicNumber,
-		NumLabels:   numLabels,
-		Labels:      labels,
-	}, nil
+// SaveLabels writes the labels to an unsigned byte IDX file that LoadLabels reads back,
+// gzip-compressed if the path ends in ".gz".
+func SaveLabels(filePath string, d *LabelData) error {
+	x := &IDX{Type: IDXUByte, Dims: []int{len(d.Labels)}, Data: append([]byte(nil), d.Labels...)}
+	return SaveIDX(filePath, x)
 }
 
 // OneHotEncode converts a single digit label into a one-hot encoded vector.
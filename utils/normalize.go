@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"image"
+
+	"github.com/coolspeed/go-mnist-scratch/preprocess"
+)
+
+const (
+	// MNISTSize is the width and height of an MNIST image.
+	MNISTSize = preprocess.MNISTSize
+	// MNISTDigitSize is the size of the box the digit is scaled into before padding, as in the original MNIST pipeline.
+	MNISTDigitSize = preprocess.MNISTDigitSize
+)
+
+// InvertMode selects whether an image is inverted to get white ink on a black background.
+type InvertMode = preprocess.InvertMode
+
+const (
+	InvertAuto   = preprocess.InvertAuto   // Invert if the border of the image is mostly bright
+	InvertAlways = preprocess.InvertAlways // Always invert (black ink on a white background)
+	InvertNever  = preprocess.InvertNever  // Never invert (the image already has white ink on black)
+)
+
+// ParseInvertMode converts a string such as "auto" into an InvertMode.
+func ParseInvertMode(s string) (InvertMode, error) {
+	return preprocess.ParseInvertMode(s)
+}
+
+// MNISTPixels converts an arbitrary image into 28x28 normalized pixels the way the MNIST digits were prepared:
+// it converts to grayscale, inverts according to mode, crops to the bounding box of the ink, scales the digit
+// to fit a 20x20 box preserving its aspect ratio and pads it to 28x28. Transparent areas count as white paper.
+// The result is not yet centered by center of mass.
+func MNISTPixels(img image.Image, mode InvertMode) []float64 {
+	p := preprocess.Pipeline{
+		preprocess.Invert{Mode: mode},
+		preprocess.Crop{},
+		preprocess.Resize{Size: MNISTDigitSize},
+		preprocess.Pad{Size: MNISTSize},
+	}
+	return p.Apply(preprocess.FromImage(img)).Pixels
+}
+
+// Preprocess returns a copy of d with every image run through p, which must keep the image size.
+func (d *ImageData) Preprocess(p preprocess.Pipeline) (*ImageData, error) {
+	images, err := p.ApplyAll(d.Images, int(d.NumRows), int(d.NumCols))
+	if err != nil {
+		return nil, err
+	}
+	processed := *d
+	processed.Images = images
+	return &processed, nil
+}
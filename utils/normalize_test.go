@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// drawDigit returns a w x h image with background bg and a rectangle of ink from rect.
+func drawDigit(w, h int, bg, ink color.Color, rect image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	draw.Draw(img, rect, &image.Uniform{C: ink}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestMNISTPixels(t *testing.T) {
+	// A 40x80 black bar on white scales to 10x20 and is padded to the middle of 28x28
+	img := drawDigit(100, 120, color.White, color.Black, image.Rect(30, 10, 70, 90))
+	pixels := MNISTPixels(img, InvertAuto)
+
+	if len(pixels) != MNISTSize*MNISTSize {
+		t.Fatalf("Expected %d pixels, got %d", MNISTSize*MNISTSize, len(pixels))
+	}
+	sum := 0.0
+	minX, maxX, minY, maxY := MNISTSize, -1, MNISTSize, -1
+	for i, v := range pixels {
+		sum += v
+		if v > 0.5 {
+			x, y := i%MNISTSize, i/MNISTSize
+			minX, maxX = min(minX, x), max(maxX, x)
+			minY, maxY = min(minY, y), max(maxY, y)
+		}
+	}
+	if math.Abs(sum-200) > 1e-6 {
+		t.Errorf("Expected total ink of 200 (10x20 box), got %f", sum)
+	}
+	if minX != 9 || maxX != 18 || minY != 4 || maxY != 23 {
+		t.Errorf("Expected ink in x 9-18, y 4-23, got x %d-%d, y %d-%d", minX, maxX, minY, maxY)
+	}
+
+	// The same digit drawn white on black must not be inverted in auto mode
+	dark := drawDigit(100, 120, color.Black, color.White, image.Rect(30, 10, 70, 90))
+	darkPixels := MNISTPixels(dark, InvertAuto)
+	for i := range pixels {
+		if math.Abs(pixels[i]-darkPixels[i]) > 1e-9 {
+			t.Fatalf("Pixel %d differs between black-on-white and white-on-black input: %f vs %f", i, pixels[i], darkPixels[i])
+		}
+	}
+
+	// Black ink on a transparent background is treated as ink on white paper
+	transparent := drawDigit(100, 120, color.Transparent, color.Black, image.Rect(30, 10, 70, 90))
+	if got := MNISTPixels(transparent, InvertAuto)[14*MNISTSize+14]; got != 1 {
+		t.Errorf("Transparent background: expected ink at the center, got %f", got)
+	}
+
+	// An empty image stays empty
+	blank := MNISTPixels(drawDigit(10, 10, color.White, color.White, image.Rectangle{}), InvertAuto)
+	for _, v := range blank {
+		if v != 0 {
+			t.Fatal("Expected an empty image for a blank input")
+		}
+	}
+}
+
+func TestMNISTPixelsAntiAliases(t *testing.T) {
+	// A 1px wide line over 80px height shrinks by 4x, leaving a faint but non-zero column
+	img := drawDigit(100, 100, color.Black, color.White, image.Rect(10, 10, 90, 90))
+	draw.Draw(img, image.Rect(50, 10, 51, 90), &image.Uniform{C: color.Black}, image.Point{}, draw.Src)
+	pixels := MNISTPixels(img, InvertNever)
+
+	// 80x80 box -> 20x20 digit at offset 4, the gap lands in column 4 + 40/4 = 14 with 3/4 coverage
+	if got := pixels[14*MNISTSize+14]; math.Abs(got-0.75) > 1e-9 {
+		t.Errorf("Expected partially covered pixel of 0.75, got %f", got)
+	}
+}
+
+func TestParseInvertMode(t *testing.T) {
+	for _, s := range []string{"auto", "always", "never"} {
+		if mode, err := ParseInvertMode(s); err != nil || string(mode) != s {
+			t.Errorf("ParseInvertMode(%q) = %q, %v", s, mode, err)
+		}
+	}
+	if _, err := ParseInvertMode("sometimes"); err == nil {
+		t.Error("ParseInvertMode should reject unknown modes")
+	}
+}